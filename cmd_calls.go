@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/calls"
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+)
+
+// runCalls prints the caller or group leaderboard from recorded calls
+func runCalls(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("calls", flag.ExitOnError)
+	by := fs.String("by", calls.BySender, "rank by sender or group")
+	horizon := fs.Int("horizon", 1440, "forward return horizon in minutes")
+	top := fs.Int("top", 20, "number of entries to list")
+	fs.Parse(args)
+
+	if *by != calls.BySender && *by != calls.ByGroup {
+		log.Fatalf("Unknown leaderboard: %s", *by)
+	}
+
+	tracker, err := calls.NewTracker(cfg, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	entries := tracker.Leaderboard(*by, time.Duration(*horizon)*time.Minute, *top)
+
+	header, prefix := "SENDER", "U"
+	if *by == calls.ByGroup {
+		header, prefix = "GROUP", ""
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tFIRST CALLS\tAVG RETURN\tWIN RATE\n", header)
+	for _, e := range entries {
+		id := fmt.Sprintf("%s%d", prefix, e.ID)
+		fmt.Fprintf(w, "%s\t%d\t%+.2f%%\t%.0f%%\n", id, e.Calls, e.AvgReturn, e.WinRate*100)
+	}
+	w.Flush()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/FuradWho/TgRadar-Go/internal/export"
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+	"github.com/FuradWho/TgRadar-Go/internal/search"
+	"github.com/FuradWho/TgRadar-Go/internal/store"
+)
+
+// runExport writes archived messages over a time range to export files
+func runExport(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	from := fs.String("from", "", "start time, RFC 3339 or YYYY-MM-DD (default 24h ago)")
+	to := fs.String("to", "", "end time, RFC 3339 or YYYY-MM-DD (default now)")
+	group := fs.Int64("group", 0, "only export this group")
+	format := fs.String("format", cfg.Export.Format, "jsonl, csv or parquet")
+	out := fs.String("out", cfg.Export.Dir, "directory to write files to")
+	fields := fs.String("fields", strings.Join(cfg.Export.Fields, ","), "comma separated fields to export (default all)")
+	hashPII := fs.Bool("hash-pii", cfg.Export.HashPII, "hash sender IDs, names and usernames")
+	fs.Parse(args)
+
+	end := time.Now()
+	if *to != "" {
+		end = parseTime(*to)
+	}
+	start := end.Add(-24 * time.Hour)
+	if *from != "" {
+		start = parseTime(*from)
+	}
+
+	switch *format {
+	case config.ExportJSONL, config.ExportCSV, config.ExportParquet:
+	default:
+		log.Fatalf("Unknown export format: %s", *format)
+	}
+	cfg.Export.Format = *format
+	cfg.Export.Dir = *out
+	cfg.Export.HashPII = *hashPII
+	if cfg.Export.HashPII && cfg.Export.HashSalt == "" {
+		log.Fatal("-hash-pii needs export.hash_salt in the config")
+	}
+	cfg.Export.Fields = nil
+	if *fields != "" {
+		cfg.Export.Fields = strings.Split(*fields, ",")
+	}
+
+	db, err := store.Open(cfg.Storage.Path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	exporter, err := export.NewExporter(cfg)
+	if err != nil {
+		db.Close()
+		log.Fatal(err)
+	}
+	exporter.Overwrite()
+
+	count := 0
+	err = db.EachMessage(context.Background(), *group, start, end, func(msg model.MessageData) error {
+		count++
+		return exporter.Write(msg)
+	})
+	// log.Fatal skips defers, close both before exiting either way
+	if closeErr := exporter.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Exported %d messages to %s", count, *out)
+}
+
+// parseTime parses a time flag, exiting on invalid input
+func parseTime(value string) time.Time {
+	t, err := search.ParseTime(value)
+	if err != nil {
+		log.Fatalf("Invalid time %q, expected RFC 3339 or YYYY-MM-DD", value)
+	}
+	return t
+}
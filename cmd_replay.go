@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/FuradWho/TgRadar-Go/internal/ai"
+	"github.com/FuradWho/TgRadar-Go/internal/analyzer"
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+)
+
+// mockProvider is the provider name the -mock flag routes every stage to
+const mockProvider = "mock"
+
+// runReplay feeds recorded messages through the analyzer offline and writes
+// the resulting reports to a directory
+func runReplay(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	in := fs.String("in", "", "JSONL file of recorded messages, - for stdin")
+	out := fs.String("out", "replay", "directory to write reports to")
+	mock := fs.Bool("mock", false, "answer with the mock provider instead of calling the LLM")
+	prices := fs.String("prices", "", "CSV of symbol,time,price rows to quote instead of the configured market source")
+	fs.Parse(args)
+
+	if *in == "" {
+		log.Fatal("replay: -in is required")
+	}
+
+	msgs, err := readMessages(*in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		log.Fatal(err)
+	}
+
+	// Keep the replay away from live state: no storage, no notifications and
+	// reputation, calls and stories files inside the output directory
+	cfg.Storage.Path = ""
+	cfg.Reputation.File = filepath.Join(*out, "reputation.json")
+	cfg.Calls.File = filepath.Join(*out, "calls.json")
+	cfg.Cluster.File = filepath.Join(*out, "stories.json")
+	// Live prices would make reports depend on when the replay runs
+	if *prices != "" {
+		cfg.Market.Source, cfg.Market.FixtureFile = "fixture", *prices
+	} else if cfg.Market.Source != "fixture" && cfg.Market.Source != "" {
+		log.Printf("Replay: market source %s ignored, pass -prices to quote from a fixture", cfg.Market.Source)
+		cfg.Market.Source = ""
+	}
+	if *mock {
+		cfg.AI.Providers = map[string]config.ProviderConfig{mockProvider: {Type: config.ProviderMock}}
+		cfg.AI.GroupModels = []config.ModelRef{{Provider: mockProvider, Model: "mock"}}
+		cfg.AI.SummaryModels = cfg.AI.GroupModels
+		if cfg.AI.Embedding.Model != "" {
+			cfg.AI.Embedding.Provider = mockProvider
+		}
+	}
+
+	anal, err := analyzer.NewManager(cfg, ai.NewClient(cfg), nil, nil, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	anal.WriteReportsTo(*out)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	anal.Replay(ctx, msgs)
+	log.Printf("Replayed %d messages, reports written to %s", len(msgs), *out)
+}
+
+// readMessages decodes one model.MessageData per line, skipping blank lines
+func readMessages(path string) ([]model.MessageData, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var msgs []model.MessageData
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var msg model.MessageData
+		if err := json.Unmarshal([]byte(text), &msg); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, scanner.Err()
+}
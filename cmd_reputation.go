@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/FuradWho/TgRadar-Go/internal/reputation"
+)
+
+// runReputation prints sender reputation from the persisted history
+func runReputation(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("reputation", flag.ExitOnError)
+	top := fs.Int("top", 20, "number of senders to list")
+	user := fs.Int64("user", 0, "show a single sender by ID, negated for channels")
+	fs.Parse(args)
+
+	tracker, err := reputation.NewTracker(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var senders []reputation.Sender
+	if *user != 0 {
+		sender, ok := tracker.Sender(*user)
+		if !ok {
+			log.Fatalf("No history for sender %d", *user)
+		}
+		senders = append(senders, sender)
+	} else {
+		senders = tracker.Top(*top)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SENDER\tSCORE\tMESSAGES\tWINDOWS\tREPLIES\tCALLS\tHITS\tADMIN\tLAST SEEN")
+	for _, s := range senders {
+		fmt.Fprintf(w, "%s\t%.2f\t%d\t%d\t%d\t%d\t%d\t%v\t%s\n",
+			reputation.Label(s.ID), s.Score(0), s.Messages, s.Windows, s.RepliesReceived, s.Calls, s.Hits, s.Admin(0),
+			s.LastSeen.Format("2006-01-02 15:04"))
+	}
+	w.Flush()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/FuradWho/TgRadar-Go/internal/ai"
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/FuradWho/TgRadar-Go/internal/cost"
+	"github.com/FuradWho/TgRadar-Go/internal/search"
+	"github.com/FuradWho/TgRadar-Go/internal/store"
+)
+
+// runSearch searches archived messages, the query is the remaining arguments
+func runSearch(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	group := fs.Int64("group", 0, "only search this group")
+	sender := fs.Int64("sender", 0, "only search this sender")
+	entity := fs.String("entity", "", "only messages mentioning this ticker or contract")
+	from := fs.String("from", "", "start time, RFC 3339 or YYYY-MM-DD")
+	to := fs.String("to", "", "end time (exclusive), RFC 3339 or YYYY-MM-DD")
+	semantic := fs.Bool("semantic", false, "rank by embedding similarity instead of full-text match")
+	limit := fs.Int("limit", search.DefaultLimit, "maximum number of results")
+	fs.Parse(args)
+
+	q := search.Query{
+		Text: strings.Join(fs.Args(), " "),
+		MessageFilter: store.MessageFilter{
+			GroupID:  *group,
+			SenderID: *sender,
+			Entity:   search.NormalizeEntity(*entity),
+		},
+		Semantic: *semantic,
+		Limit:    *limit,
+	}
+	if *from != "" {
+		q.From = parseTime(*from)
+	}
+	if *to != "" {
+		q.To = parseTime(*to)
+	}
+
+	db, err := store.Open(cfg.Storage.Path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	hits, err := search.NewSearcher(cfg, db, ai.NewClient(cfg), cost.NewTracker(cfg, db)).Search(context.Background(), q)
+	// log.Fatal skips defers, close the store first
+	db.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(search.FormatHits(hits))
+}
@@ -2,15 +2,57 @@ package ai
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/FuradWho/TgRadar-Go/internal/config"
-	openai "github.com/sashabaranov/go-openai"
+	"github.com/FuradWho/TgRadar-Go/internal/metrics"
 )
 
+// Client runs each pipeline stage through an ordered chain of provider/model
+// pairs, failing over on errors, timeouts and empty responses
 type Client struct {
-	client *openai.Client
-	cfg    *config.Config
+	cfg       *config.Config
+	providers map[string]Provider
+	chains    map[string][]config.ModelRef
+	// Model used instead of the configured chain while over budget
+	fallbackModel string
+	mu            sync.Mutex
+}
+
+// Stages label which part of the pipeline a request belongs to
+const (
+	StageGroup     = "group"
+	StageSummary   = "summary"
+	StageEmbedding = "embedding"
+	StageAsk       = "ask"
+	StageTranslate = "translate"
+)
+
+// Per-attempt timeouts, each model in a chain gets its own
+const (
+	groupAttemptTimeout   = 30 * time.Second
+	summaryAttemptTimeout = 45 * time.Second
+)
+
+// Usage is the token count of a single request
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
+// Result is a model response along with what produced it and what it cost
+type Result struct {
+	Content  string
+	Provider string
+	Model    string
+	Usage    Usage
 }
 
 const groupBriefingPrompt = `# Role
@@ -80,6 +122,8 @@ const summaryBriefingPrompt = `# Role
 4. **统计**：统计每个话题的参与讨论人数（根据不同的用户名计数）。
 5. **实体识别**：准确提取币种名称（如 BTC, ETH, SPACE）或事件关键词。
 6. **语言风格**：金融专业简报风格，客观、精炼、使用中文。
+7. **行情核实**：若输入中附有“行情参考”，涉及价格与涨跌的描述以其为准，不要编造价格数据。
+8. **话题聚类**：若输入中附有“话题聚类”，以其划分话题，讨论人数与群数直接采用其中的统计；对“持续话题”说明与之前相比的进展。
 
 # Output Format (Strictly Follow)
 请严格按照以下 Markdown 格式输出，不要包含任何 Markdown 代码块标记，直接输出文本。  
@@ -121,87 +165,338 @@ const summaryBriefingPrompt = `# Role
 # Action  
 现在，请处理以下输入数据：  `
 
+const newsBriefingPrompt = `# Role
+你是一个资深的加密货币新闻编辑。你擅长从新闻频道和低频群聊中筛选真正影响市场的事件。
+
+# Task
+请分析用户提供的频道消息，生成一份《新闻快讯》。
+
+# Constraints & Rules
+1. **去重**：同一事件的多条报道只保留一条，合并补充细节。
+2. **筛选**：忽略广告、推广、抽奖及与市场无关的内容。
+3. **影响判断**：判断每条新闻对相关币种或大盘的潜在影响（利好、利空、中性）。
+4. **实体识别**：准确提取币种名称（如 BTC, ETH, SPACE）、项目方或机构名称。
+5. **语言风格**：新闻简报风格，客观、精炼、使用中文。
+
+# Output Format (Strictly Follow)
+请严格按照以下 Markdown 格式输出，不要包含任何 Markdown 代码块标记，直接输出文本。  
+
+📰 新闻快讯  
+
+━━━━━━━━━━━━━━━━━━━━  
+🔔 重要事件  
+━━━━━━━━━━━━━━━━━━━━  
+
+• [新闻主角]｜[新闻事件简述] 【[利好/利空/中性]】  
+(以此类推，按重要程度排序，最多列出 5 个)  
+
+# Action  
+现在，请处理以下输入数据：  `
+
+const translatePrompt = `你是一个专业的加密货币社群翻译。请将用户提供的 JSON 字符串数组中的每条消息翻译为%s。
+
+# Rules
+1. 币种代码、合约地址、链接、数字和 @用户名 保持原样，不要翻译。
+2. 保留原文的口语语气，不要解释、总结或补充内容。
+3. 只输出一个 JSON 字符串数组，长度和顺序与输入完全一致，不要包含代码块标记。`
+
+const askPrompt = `# Role
+你是一个加密货币社群情报助手，根据已采集的群聊消息和历史分析报告回答交易员的问题。
+
+# Constraints & Rules
+1. **只依据资料**：只使用用户提供的资料作答，资料不足以回答时直接说明，不要编造。
+2. **引用来源**：每个论点后用方括号标注来源编号，消息为 [G群组ID#消息ID]，报告为 [R报告ID]，编号必须与资料中的一致。
+3. **区分观点与事实**：群友的观点、传闻要注明是讨论内容，不要当作已证实的事实。
+4. **语言风格**：简洁专业，使用中文，控制在 300 字以内。`
+
+// promptProfiles holds the built-in group prompts, selectable per group
+var promptProfiles = map[string]string{
+	"default": groupBriefingPrompt,
+	"news":    newsBriefingPrompt,
+}
+
 func NewClient(cfg *config.Config) *Client {
-	aiConfig := openai.DefaultConfig(cfg.AI.APIKey)
-	if cfg.AI.BaseURL != "" {
-		aiConfig.BaseURL = cfg.AI.BaseURL
-	}
-
-	return &Client{
-		client: openai.NewClientWithConfig(aiConfig),
-		cfg:    cfg,
-	}
-}
-
-// Analyze performs AI analysis on chat logs
-func (c *Client) Analyze(ctx context.Context, chatLog string) (string, error) {
-	// Crafted Prompt (Prompt Engineering)
-	systemPrompt := groupBriefingPrompt
-
-	resp, err := c.client.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Model: c.cfg.AI.Model,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleSystem,
-					Content: systemPrompt,
-				},
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: fmt.Sprintf("以下是最近的聊天记录：\n\n%s", chatLog),
-				},
-			},
-			// Control output length
-			MaxTokens: 800,
-			// Lower temperature for more objective results
-			Temperature: 0.3,
+	c := &Client{
+		cfg:       cfg,
+		providers: make(map[string]Provider),
+		chains: map[string][]config.ModelRef{
+			StageGroup:   modelChain(cfg, cfg.AI.GroupModels),
+			StageSummary: modelChain(cfg, cfg.AI.SummaryModels),
+			// Questions go to the summary models, they see the most context
+			StageAsk:       modelChain(cfg, cfg.AI.SummaryModels),
+			StageTranslate: modelChain(cfg, cfg.AI.GroupModels),
 		},
-	)
+	}
+
+	// Translation runs on the group models unless it has its own chain
+	if len(cfg.AI.TranslateModels) > 0 {
+		c.chains[StageTranslate] = modelChain(cfg, cfg.AI.TranslateModels)
+	}
+
+	c.providers[config.DefaultProvider] = NewOpenAIProvider(cfg.AI.APIKey, cfg.AI.BaseURL)
+	for name, pc := range cfg.AI.Providers {
+		if pc.Type == config.ProviderMock {
+			c.providers[name] = MockProvider{}
+			continue
+		}
+		c.providers[name] = NewOpenAIProvider(pc.APIKey, pc.BaseURL)
+	}
+	return c
+}
+
+// modelChain fills in the default provider and falls back to ai.model
+func modelChain(cfg *config.Config, refs []config.ModelRef) []config.ModelRef {
+	if len(refs) == 0 {
+		return []config.ModelRef{{Provider: config.DefaultProvider, Model: cfg.AI.Model}}
+	}
+
+	chain := make([]config.ModelRef, len(refs))
+	for i, ref := range refs {
+		if ref.Provider == "" {
+			ref.Provider = config.DefaultProvider
+		}
+		chain[i] = ref
+	}
+	return chain
+}
+
+// errStreamIdle aborts a stream that stopped producing tokens
+var errStreamIdle = errors.New("AI stream idle timeout")
+
+// complete tries each model of the stage's chain in order until one answers.
+// A non-nil onDelta streams the output where the provider supports it, and
+// if every model fails the longest partial output is returned with the error.
+func (c *Client) complete(ctx context.Context, stage string, req Request, onDelta func(content string)) (Result, error) {
+	timeout := groupAttemptTimeout
+	if stage == StageSummary || stage == StageAsk {
+		timeout = summaryAttemptTimeout
+	}
 
+	var partial Result
+	var errs []error
+	for _, ref := range c.chain(stage) {
+		if ctx.Err() != nil {
+			break
+		}
+
+		req.Model = ref.Model
+		result, err := c.attempt(ctx, stage, ref.Provider, req, timeout, onDelta)
+		if err == nil {
+			return result, nil
+		}
+		log.Printf("AI %s request to %s/%s failed: %v", stage, ref.Provider, ref.Model, err)
+		errs = append(errs, fmt.Errorf("%s/%s: %w", ref.Provider, ref.Model, err))
+		if len(result.Content) > len(partial.Content) {
+			partial = result
+		}
+	}
+	if len(errs) == 0 {
+		return partial, ctx.Err()
+	}
+	return partial, errors.Join(errs...)
+}
+
+// attempt sends one request and records latency, token usage and errors
+func (c *Client) attempt(ctx context.Context, stage, providerName string, req Request, timeout time.Duration, onDelta func(content string)) (Result, error) {
+	provider, ok := c.providers[providerName]
+	if !ok {
+		return Result{}, fmt.Errorf("unknown provider %s", providerName)
+	}
+
+	start := time.Now()
+	var result Result
+	var err error
+	if streamer, ok := provider.(StreamProvider); ok && onDelta != nil && c.cfg.AI.Stream {
+		result, err = streamWithIdleTimeout(ctx, streamer, req, timeout, onDelta)
+	} else {
+		ctxWithTimeout, cancel := context.WithTimeout(ctx, timeout)
+		result, err = provider.Complete(ctxWithTimeout, req)
+		cancel()
+	}
+	metrics.LLMRequestDuration.WithLabelValues(providerName, req.Model, stage).Observe(time.Since(start).Seconds())
+	metrics.LLMTokens.WithLabelValues(providerName, req.Model, "prompt").Add(float64(result.Usage.PromptTokens))
+	metrics.LLMTokens.WithLabelValues(providerName, req.Model, "completion").Add(float64(result.Usage.CompletionTokens))
+
+	result.Provider = providerName
+	result.Model = req.Model
+	if err == nil && strings.TrimSpace(result.Content) == "" {
+		err = fmt.Errorf("AI response is empty")
+	}
 	if err != nil {
-		return "", err
+		metrics.LLMErrors.WithLabelValues(providerName, req.Model).Inc()
+	}
+	return result, err
+}
+
+// streamWithIdleTimeout only gives up once no token arrived for timeout, so
+// long answers are not cut off as long as they keep coming
+func streamWithIdleTimeout(ctx context.Context, streamer StreamProvider, req Request, timeout time.Duration, onDelta func(content string)) (Result, error) {
+	streamCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	idle := time.AfterFunc(timeout, func() { cancel(errStreamIdle) })
+	defer idle.Stop()
+
+	result, err := streamer.Stream(streamCtx, req, func(content string) {
+		idle.Reset(timeout)
+		onDelta(content)
+	})
+	if err != nil && errors.Is(context.Cause(streamCtx), errStreamIdle) {
+		err = errStreamIdle
 	}
+	return result, err
+}
+
+// chain returns the models to try for a stage, collapsed to the fallback model while over budget
+func (c *Client) chain(stage string) []config.ModelRef {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("AI response is empty")
+	chain := c.chains[stage]
+	if c.fallbackModel != "" && len(chain) > 0 {
+		return []config.ModelRef{{Provider: chain[0].Provider, Model: c.fallbackModel}}
 	}
+	return chain
+}
 
-	return resp.Choices[0].Message.Content, nil
+// Analyze performs AI analysis on chat logs using the given prompt profile
+func (c *Client) Analyze(ctx context.Context, profile string, chatLog string) (Result, error) {
+	return c.complete(ctx, StageGroup, Request{
+		// Crafted Prompt (Prompt Engineering)
+		System: c.groupPrompt(profile),
+		User:   fmt.Sprintf("以下是最近的聊天记录：\n\n%s", chatLog),
+		// Control output length
+		MaxTokens: 800,
+		// Lower temperature for more objective results
+		Temperature: 0.3,
+	}, nil)
 }
 
 // AnalyzeSummary performs a summary analysis on multiple group reports
-func (c *Client) AnalyzeSummary(ctx context.Context, summaries string) (string, error) {
-	systemPrompt := summaryBriefingPrompt
-
-	resp, err := c.client.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Model: c.cfg.AI.Model,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleSystem,
-					Content: systemPrompt,
-				},
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: fmt.Sprintf("以下是多个群聊的分析报告：\n\n%s", summaries),
-				},
-			},
-			// Control output length for summary
-			MaxTokens: 1000,
-			// Lower temperature for consistent summarization
-			Temperature: 0.3,
-		},
-	)
+func (c *Client) AnalyzeSummary(ctx context.Context, summaries string) (Result, error) {
+	return c.AnalyzeSummaryStream(ctx, summaries, nil)
+}
 
+// AnalyzeSummaryStream is AnalyzeSummary calling onDelta with the summary
+// generated so far. On failure the partial summary, if any, is returned
+// along with the error.
+func (c *Client) AnalyzeSummaryStream(ctx context.Context, summaries string, onDelta func(content string)) (Result, error) {
+	return c.complete(ctx, StageSummary, Request{
+		System: summaryBriefingPrompt,
+		User:   fmt.Sprintf("以下是多个群聊的分析报告：\n\n%s", summaries),
+		// Control output length for summary
+		MaxTokens: 1000,
+		// Lower temperature for consistent summarization
+		Temperature: 0.3,
+	}, onDelta)
+}
+
+// Ask answers a question from the retrieved sources, citing them by their labels
+func (c *Client) Ask(ctx context.Context, question, sources string) (Result, error) {
+	return c.complete(ctx, StageAsk, Request{
+		System:      askPrompt,
+		User:        fmt.Sprintf("# 资料\n\n%s\n\n# 问题\n\n%s", sources, question),
+		MaxTokens:   800,
+		Temperature: 0.2,
+	}, nil)
+}
+
+// Translate translates each text into language, returning one translation
+// per text. The completion is allowed a few tokens per input byte, up to
+// translate.max_tokens.
+func (c *Client) Translate(ctx context.Context, language string, texts []string) ([]string, Result, error) {
+	input, err := json.Marshal(texts)
+	if err != nil {
+		return nil, Result{}, err
+	}
+	result, err := c.complete(ctx, StageTranslate, Request{
+		System:      fmt.Sprintf(translatePrompt, language),
+		User:        string(input),
+		MaxTokens:   min(4*len(input), c.cfg.Translate.MaxTokens),
+		Temperature: 0,
+	}, nil)
 	if err != nil {
-		return "", err
+		return nil, result, err
 	}
 
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("AI response is empty")
+	// Models sometimes wrap the array in a code block or a sentence
+	content := result.Content
+	start, end := strings.Index(content, "["), strings.LastIndex(content, "]")
+	if start < 0 || end < start {
+		return nil, result, fmt.Errorf("translation is not a JSON array")
 	}
+	var translations []string
+	if err := json.Unmarshal([]byte(content[start:end+1]), &translations); err != nil {
+		return nil, result, fmt.Errorf("parse translation: %w", err)
+	}
+	if len(translations) != len(texts) {
+		return nil, result, fmt.Errorf("got %d translations for %d texts", len(translations), len(texts))
+	}
+	return translations, result, nil
+}
+
+// embedTimeout bounds a single embedding request
+const embedTimeout = 30 * time.Second
+
+// EmbeddingModel returns the configured embedding model, empty when semantic search is off
+func (c *Client) EmbeddingModel() string {
+	return c.cfg.AI.Embedding.Model
+}
+
+// Embed embeds texts with the configured embedding model. The result
+// carries the provider, model and usage for cost tracking.
+func (c *Client) Embed(ctx context.Context, texts []string) ([][]float32, Result, error) {
+	ref := c.cfg.AI.Embedding
+	if ref.Model == "" {
+		return nil, Result{}, fmt.Errorf("no embedding model configured")
+	}
+	if ref.Provider == "" {
+		ref.Provider = config.DefaultProvider
+	}
+	embedder, ok := c.providers[ref.Provider].(Embedder)
+	if !ok {
+		return nil, Result{}, fmt.Errorf("provider %s cannot embed", ref.Provider)
+	}
+
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, embedTimeout)
+	defer cancel()
 
-	return resp.Choices[0].Message.Content, nil
+	start := time.Now()
+	vectors, usage, err := embedder.Embed(ctxWithTimeout, ref.Model, texts)
+	metrics.LLMRequestDuration.WithLabelValues(ref.Provider, ref.Model, StageEmbedding).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.LLMErrors.WithLabelValues(ref.Provider, ref.Model).Inc()
+		return nil, Result{}, err
+	}
+	metrics.LLMTokens.WithLabelValues(ref.Provider, ref.Model, "prompt").Add(float64(usage.PromptTokens))
+	return vectors, Result{Provider: ref.Provider, Model: ref.Model, Usage: usage}, nil
+}
+
+// SetFallbackModel switches every request to model, an empty model restores the configured chains
+func (c *Client) SetFallbackModel(model string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if model != c.fallbackModel {
+		if model != "" {
+			log.Printf("Switching AI model to %s", model)
+		} else {
+			log.Printf("Restoring configured AI models")
+		}
+	}
+	c.fallbackModel = model
+}
+
+// groupPrompt resolves a prompt profile, custom profiles from config take precedence
+func (c *Client) groupPrompt(profile string) string {
+	// Viper lowercases map keys
+	if prompt, ok := c.cfg.AI.PromptProfiles[strings.ToLower(profile)]; ok && prompt != "" {
+		return prompt
+	}
+	if prompt, ok := promptProfiles[profile]; ok {
+		return prompt
+	}
+	if profile != "" && profile != "default" {
+		log.Printf("Unknown prompt profile %q, using default", profile)
+	}
+	return groupBriefingPrompt
 }
@@ -0,0 +1,82 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// mockDimensions is the size of mock embeddings
+const mockDimensions = 64
+
+// MockProvider answers without calling any API. It echoes the prompt, so
+// replays produce deterministic reports that can be compared to golden files.
+type MockProvider struct{}
+
+func (MockProvider) Complete(ctx context.Context, req Request) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	content := fmt.Sprintf("[mock %s] %d 行输入\n%s", req.Model, strings.Count(req.User, "\n")+1, req.User)
+	// Translation requests are a JSON array and expect one back
+	var texts []string
+	if json.Unmarshal([]byte(req.User), &texts) == nil {
+		for i, text := range texts {
+			texts[i] = fmt.Sprintf("[mock %s] %s", req.Model, text)
+		}
+		data, _ := json.Marshal(texts)
+		content = string(data)
+	}
+	// Rough estimate of 4 characters per token
+	prompt := (utf8.RuneCountInString(req.System) + utf8.RuneCountInString(req.User)) / 4
+	completion := utf8.RuneCountInString(content) / 4
+	return Result{
+		Content: content,
+		Model:   req.Model,
+		Usage: Usage{
+			PromptTokens:     prompt,
+			CompletionTokens: completion,
+			TotalTokens:      prompt + completion,
+		},
+	}, nil
+}
+
+// Embed hashes character trigrams into a normalized vector, so texts sharing
+// wording end up close without calling an API
+func (MockProvider) Embed(ctx context.Context, model string, texts []string) ([][]float32, Usage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Usage{}, err
+	}
+
+	var usage Usage
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		usage.PromptTokens += utf8.RuneCountInString(text) / 4
+		v := make([]float32, mockDimensions)
+		runes := []rune(strings.ToLower(text))
+		for j := 0; j+3 <= len(runes); j++ {
+			h := fnv.New32a()
+			h.Write([]byte(string(runes[j : j+3])))
+			v[h.Sum32()%mockDimensions]++
+		}
+
+		var norm float64
+		for _, x := range v {
+			norm += float64(x * x)
+		}
+		if norm > 0 {
+			scale := float32(1 / math.Sqrt(norm))
+			for j := range v {
+				v[j] *= scale
+			}
+		}
+		vectors[i] = v
+	}
+	usage.TotalTokens = usage.PromptTokens
+	return vectors, usage, nil
+}
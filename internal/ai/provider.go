@@ -0,0 +1,152 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Request is a single-turn chat completion request
+type Request struct {
+	Model       string
+	System      string
+	User        string
+	MaxTokens   int
+	Temperature float32
+}
+
+// Provider sends chat completions to one LLM backend
+type Provider interface {
+	Complete(ctx context.Context, req Request) (Result, error)
+}
+
+// StreamProvider is a Provider that can also stream its output. onDelta
+// receives the content generated so far, on error the partial content is
+// returned along with it.
+type StreamProvider interface {
+	Provider
+	Stream(ctx context.Context, req Request, onDelta func(content string)) (Result, error)
+}
+
+// Embedder is a Provider that can also embed texts, one vector per text
+type Embedder interface {
+	Embed(ctx context.Context, model string, texts []string) ([][]float32, Usage, error)
+}
+
+// OpenAIProvider talks to any OpenAI-compatible API (OpenAI, DeepSeek, ...)
+type OpenAIProvider struct {
+	client *openai.Client
+}
+
+func NewOpenAIProvider(apiKey, baseURL string) *OpenAIProvider {
+	aiConfig := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		aiConfig.BaseURL = baseURL
+	}
+	return &OpenAIProvider{client: openai.NewClientWithConfig(aiConfig)}
+}
+
+func (p *OpenAIProvider) Complete(ctx context.Context, req Request) (Result, error) {
+	resp, err := p.client.CreateChatCompletion(ctx, chatRequest(req))
+	if err != nil {
+		return Result{}, err
+	}
+	if len(resp.Choices) == 0 {
+		return Result{}, fmt.Errorf("AI response is empty")
+	}
+
+	return Result{
+		Content: resp.Choices[0].Message.Content,
+		Model:   req.Model,
+		Usage: Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+	}, nil
+}
+
+func (p *OpenAIProvider) Stream(ctx context.Context, req Request, onDelta func(content string)) (Result, error) {
+	chatReq := chatRequest(req)
+	chatReq.Stream = true
+	chatReq.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+
+	stream, err := p.client.CreateChatCompletionStream(ctx, chatReq)
+	if err != nil {
+		return Result{}, err
+	}
+	defer stream.Close()
+
+	result := Result{Model: req.Model}
+	var content strings.Builder
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			result.Content = content.String()
+			return result, err
+		}
+
+		if resp.Usage != nil {
+			result.Usage = Usage{
+				PromptTokens:     resp.Usage.PromptTokens,
+				CompletionTokens: resp.Usage.CompletionTokens,
+				TotalTokens:      resp.Usage.TotalTokens,
+			}
+		}
+		if len(resp.Choices) > 0 && resp.Choices[0].Delta.Content != "" {
+			content.WriteString(resp.Choices[0].Delta.Content)
+			onDelta(content.String())
+		}
+	}
+
+	result.Content = content.String()
+	return result, nil
+}
+
+func (p *OpenAIProvider) Embed(ctx context.Context, model string, texts []string) ([][]float32, Usage, error) {
+	resp, err := p.client.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+		Input: texts,
+		Model: openai.EmbeddingModel(model),
+	})
+	if err != nil {
+		return nil, Usage{}, err
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, Usage{}, fmt.Errorf("got %d embeddings for %d texts", len(resp.Data), len(texts))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, e := range resp.Data {
+		if e.Index < 0 || e.Index >= len(vectors) {
+			return nil, Usage{}, fmt.Errorf("embedding index %d out of range", e.Index)
+		}
+		vectors[e.Index] = e.Embedding
+	}
+	usage := Usage{PromptTokens: resp.Usage.PromptTokens, TotalTokens: resp.Usage.TotalTokens}
+	return vectors, usage, nil
+}
+
+func chatRequest(req Request) openai.ChatCompletionRequest {
+	return openai.ChatCompletionRequest{
+		Model: req.Model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: req.System,
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: req.User,
+			},
+		},
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+	}
+}
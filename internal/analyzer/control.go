@@ -0,0 +1,119 @@
+package analyzer
+
+import (
+	"maps"
+	"sort"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/preprocess"
+)
+
+// GroupStatus describes a monitored group
+type GroupStatus struct {
+	ID             int64            `json:"id"`
+	Source         string           `json:"source,omitempty"`
+	Buffered       int              `json:"buffered"`
+	Paused         bool             `json:"paused"`
+	WindowStart    time.Time        `json:"window_start"`
+	WindowSeconds  int              `json:"window_seconds"`
+	MinMessages    int              `json:"min_messages"`
+	MinSenders     int              `json:"min_senders"`
+	MaxWaitSeconds int              `json:"max_wait_seconds"`
+	PromptProfile  string           `json:"prompt_profile"`
+	Filtered       preprocess.Stats `json:"filtered,omitempty"`
+	// Analyzed messages per detected language
+	Languages map[string]int `json:"languages,omitempty"`
+}
+
+// Status is a snapshot of the analyzer's buffers
+type Status struct {
+	QueueDepth     int           `json:"queue_depth"`
+	QueueCapacity  int           `json:"queue_capacity"`
+	PendingReports int           `json:"pending_reports"`
+	Groups         []GroupStatus `json:"groups"`
+}
+
+// Groups lists configured groups and every group a message has been seen from
+func (m *Manager) Groups() []GroupStatus {
+	filterStats := m.FilterStats()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := make(map[int64]struct{})
+	for _, id := range m.cfg.TargetGroups() {
+		ids[id] = struct{}{}
+	}
+	for _, g := range m.cfg.Monitor.Groups {
+		ids[g.ID] = struct{}{}
+	}
+	for id := range m.windowStart {
+		ids[id] = struct{}{}
+	}
+	for id := range m.paused {
+		ids[id] = struct{}{}
+	}
+
+	groups := make([]GroupStatus, 0, len(ids))
+	for id := range ids {
+		settings := m.settings(id)
+		groups = append(groups, GroupStatus{
+			ID:             id,
+			Source:         m.sources[id],
+			Buffered:       len(m.windowBuffer[id]),
+			Paused:         m.paused[id],
+			WindowStart:    m.windowStart[id],
+			WindowSeconds:  settings.WindowSeconds,
+			MinMessages:    settings.MinMessages,
+			MinSenders:     settings.MinSenders,
+			MaxWaitSeconds: settings.MaxWaitSeconds,
+			PromptProfile:  settings.PromptProfile,
+			Filtered:       filterStats[id],
+			Languages:      maps.Clone(m.languageStats[id]),
+		})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	return groups
+}
+
+// Status reports queue depth and per-group buffer sizes
+func (m *Manager) Status() Status {
+	groups := m.Groups()
+
+	m.mu.Lock()
+	pending := len(m.pendingReports)
+	m.mu.Unlock()
+
+	return Status{
+		QueueDepth:     len(m.msgChan),
+		QueueCapacity:  cap(m.msgChan),
+		PendingReports: pending,
+		Groups:         groups,
+	}
+}
+
+// TriggerAnalysis analyzes every buffered group and summarizes right away.
+// Requests made while one is already queued are merged.
+func (m *Manager) TriggerAnalysis() {
+	select {
+	case m.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Pause stops collecting messages for a group and discards its buffer
+func (m *Manager) Pause(groupID int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.paused[groupID] = true
+	delete(m.windowBuffer, groupID)
+}
+
+// Resume collects messages for a paused group again
+func (m *Manager) Resume(groupID int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.paused, groupID)
+}
@@ -0,0 +1,61 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/ai"
+	"github.com/FuradWho/TgRadar-Go/internal/cost"
+)
+
+// recordUsage attributes the tokens of one call to a group and window
+func (m *Manager) recordUsage(ctx context.Context, groupID int64, stage string, result ai.Result, start, end time.Time) {
+	m.debugf("Group %d %s tokens: prompt %d, completion %d (%s)", groupID, stage,
+		result.Usage.PromptTokens, result.Usage.CompletionTokens, result.Model)
+
+	if m.cost == nil {
+		return
+	}
+	if err := m.cost.Record(ctx, groupID, stage, result, start, end); err != nil {
+		log.Printf("Usage record failed: %v", err)
+	}
+}
+
+// applyBudget switches to the fallback model while over budget and reports
+// whether the budget is exceeded
+func (m *Manager) applyBudget(ctx context.Context, now time.Time) bool {
+	if m.cost == nil {
+		return false
+	}
+
+	over, err := m.cost.OverBudget(ctx, now)
+	if err != nil {
+		log.Printf("Budget check failed: %v", err)
+		return false
+	}
+
+	if over {
+		m.aiClient.SetFallbackModel(m.cfg.Cost.FallbackModel)
+	} else {
+		m.aiClient.SetFallbackModel("")
+	}
+	return over
+}
+
+// CostReport renders running LLM cost totals for the /cost command
+func (m *Manager) CostReport(ctx context.Context) (string, error) {
+	if m.cost == nil {
+		return "", fmt.Errorf("cost tracking requires storage.path")
+	}
+	return m.cost.Report(ctx, time.Now())
+}
+
+// CostTotals returns running LLM cost totals for the current day and month
+func (m *Manager) CostTotals(ctx context.Context) (cost.Totals, error) {
+	if m.cost == nil {
+		return cost.Totals{}, fmt.Errorf("cost tracking requires storage.path")
+	}
+	return m.cost.Totals(ctx, time.Now())
+}
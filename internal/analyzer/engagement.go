@@ -0,0 +1,158 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+)
+
+// engagementLegend explains the engagement tags of the chat log
+const engagementLegend = "注：方括号内为互动数据（表情回应及其数量、💬 为回复数），互动越多的消息越受关注\n\n"
+
+// tagReactions is how many reaction kinds a chat log line shows
+const tagReactions = 3
+
+// Refresher fetches the current engagement of messages from Telegram
+type Refresher interface {
+	Refresh(ctx context.Context, account string, groupID int64, source string, msgIDs []int) ([]model.Engagement, error)
+}
+
+// RefreshVia sets where engagement is re-fetched from before a window is
+// analyzed, used when engagement.refresh is enabled
+func (m *Manager) RefreshVia(r Refresher) {
+	m.refresher = r
+}
+
+// UpdateEngagement applies a reaction, view or forward update to a buffered
+// message and to its copy waiting for the global summary. Messages already
+// in a report are left as they were.
+func (m *Manager) UpdateEngagement(e model.Engagement) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	buffer := m.windowBuffer[e.GroupID]
+	for i := len(buffer) - 1; i >= 0; i-- {
+		if buffer[i].MsgID == e.MsgID && sameMessageIDs(buffer[i], e.Account) {
+			applyEngagement(&buffer[i], e)
+			break
+		}
+	}
+	for i := len(m.pendingMessages) - 1; i >= 0; i-- {
+		msg := &m.pendingMessages[i]
+		if msg.GroupID == e.GroupID && msg.MsgID == e.MsgID && sameMessageIDs(*msg, e.Account) {
+			applyEngagement(msg, e)
+			return
+		}
+	}
+}
+
+// sameMessageIDs reports whether message IDs of msg match those seen by
+// account. Channels and supergroups share them, other chats number messages
+// per account.
+func sameMessageIDs(msg model.MessageData, account string) bool {
+	return msg.Source == model.SourceChannel || msg.Source == model.SourceSupergroup || msg.Account == account
+}
+
+// applyEngagement keeps the latest counters, which only grow apart from
+// reactions being withdrawn
+func applyEngagement(msg *model.MessageData, e model.Engagement) {
+	if e.Reactions != nil {
+		msg.Reactions = e.Reactions
+	}
+	msg.Views = max(msg.Views, e.Views)
+	msg.Forwards = max(msg.Forwards, e.Forwards)
+	msg.Replies = max(msg.Replies, e.Replies)
+}
+
+// refreshEngagement re-fetches the engagement of a window's messages through
+// the accounts that received them. Small windows and windows flushed on
+// shutdown are skipped, failures are logged and the counters already known
+// are kept.
+func (m *Manager) refreshEngagement(ctx context.Context, groupID int64, msgs []model.MessageData) {
+	if !m.cfg.Engagement.Refresh || m.refresher == nil || m.closing.Load() {
+		return
+	}
+	if len(msgs) < m.cfg.Engagement.RefreshMinMessages {
+		return
+	}
+
+	byAccount := make(map[string][]int)
+	index := make(map[string]map[int]int)
+	for i, msg := range msgs {
+		if msg.MsgID == 0 {
+			continue
+		}
+		if index[msg.Account] == nil {
+			index[msg.Account] = make(map[int]int)
+		}
+		byAccount[msg.Account] = append(byAccount[msg.Account], msg.MsgID)
+		index[msg.Account][msg.MsgID] = i
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(m.cfg.Engagement.RefreshTimeoutSeconds)*time.Second)
+	defer cancel()
+	refreshed := 0
+	for account, ids := range byAccount {
+		updates, err := m.refresher.Refresh(ctx, account, groupID, sourceOf(msgs), ids)
+		if err != nil {
+			log.Printf("Group %d: engagement refresh failed: %v", groupID, err)
+		}
+		for _, e := range updates {
+			if i, ok := index[account][e.MsgID]; ok {
+				applyEngagement(&msgs[i], e)
+				refreshed++
+			}
+		}
+	}
+	m.debugf("Group %d: refreshed engagement of %d messages", groupID, refreshed)
+}
+
+// countReplies raises each message's reply count to the replies it got
+// within the window, Telegram only counts replies in channel comments
+func countReplies(msgs []model.MessageData) {
+	replies := make(map[int]int)
+	for _, msg := range msgs {
+		if msg.ReplyToMsgID != 0 {
+			replies[msg.ReplyToMsgID]++
+		}
+	}
+	for i := range msgs {
+		if n := replies[msgs[i].MsgID]; n > 0 && msgs[i].MsgID != 0 {
+			msgs[i].Replies = max(msgs[i].Replies, n)
+		}
+	}
+}
+
+// engagementTag renders the most used reactions and the reply count of a
+// message, empty when it has neither
+func engagementTag(msg model.MessageData) string {
+	emojis := make([]string, 0, len(msg.Reactions))
+	for emoji, n := range msg.Reactions {
+		if n > 0 {
+			emojis = append(emojis, emoji)
+		}
+	}
+	sort.Slice(emojis, func(i, j int) bool {
+		if msg.Reactions[emojis[i]] != msg.Reactions[emojis[j]] {
+			return msg.Reactions[emojis[i]] > msg.Reactions[emojis[j]]
+		}
+		return emojis[i] < emojis[j]
+	})
+
+	var parts []string
+	for _, emoji := range emojis[:min(tagReactions, len(emojis))] {
+		parts = append(parts, fmt.Sprintf("%s%d", emoji, msg.Reactions[emoji]))
+	}
+	if msg.Replies > 0 {
+		parts = append(parts, fmt.Sprintf("💬%d", msg.Replies))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(parts, " ") + "]"
+}
@@ -4,170 +4,735 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/FuradWho/TgRadar-Go/internal/ai"
+	"github.com/FuradWho/TgRadar-Go/internal/calls"
+	"github.com/FuradWho/TgRadar-Go/internal/cluster"
 	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/FuradWho/TgRadar-Go/internal/cost"
+	"github.com/FuradWho/TgRadar-Go/internal/market"
+	"github.com/FuradWho/TgRadar-Go/internal/metrics"
 	"github.com/FuradWho/TgRadar-Go/internal/model"
 	"github.com/FuradWho/TgRadar-Go/internal/notifier"
+	"github.com/FuradWho/TgRadar-Go/internal/preprocess"
+	"github.com/FuradWho/TgRadar-Go/internal/reputation"
+	"github.com/FuradWho/TgRadar-Go/internal/store"
+	"github.com/FuradWho/TgRadar-Go/internal/translate"
 )
 
 type Manager struct {
 	cfg          *config.Config
 	aiClient     *ai.Client
 	notifier     notifier.Sender
+	pipeline     *preprocess.Pipeline
+	reputation   *reputation.Tracker
+	calls        *calls.Tracker
+	prices       market.PriceSource
+	store        *store.Store
+	cost         *cost.Tracker
 	msgChan      chan model.MessageData
+	trigger      chan struct{}
 	windowBuffer map[int64][]model.MessageData
-	mu           sync.Mutex
+	windowStart  map[int64]time.Time
+	// Kind of chat of every group a message was seen from, settings depend on it
+	sources map[int64]string
+	// Group reports waiting for the next global summary
+	pendingReports []string
+	// Ticker mentions since the last global summary
+	pendingTickers map[string]tickerCount
+	// Filtered messages clustered into topics at the next global summary
+	pendingMessages []model.MessageData
+	stories         *cluster.Tracker
+	epoch           time.Time
+	lastSummary     time.Time
+	paused          map[int64]bool
+	// Cumulative messages removed by each filter, per group
+	filterStats map[int64]preprocess.Stats
+	// Cumulative analyzed messages per detected language, per group
+	languageStats map[int64]map[string]int
+	translator    *translate.Translator
+	// Re-fetches engagement before analysis, nil when not wired
+	refresher Refresher
+	// Directory reports are also written to as files, used by replays
+	reportDir string
+	// Analyze due groups one at a time so replays are deterministic
+	serial bool
+	// Set once shutdown starts, new messages are dropped from then on
+	closing atomic.Bool
+	mu      sync.Mutex
 }
 
-const globalSummaryBanner = "\n====== GLOBAL INTELLIGENCE SUMMARY ======\n%s\n========================================="
+const highSignalLegend = "注：带 ★ 的用户历史信号质量较高\n\n"
 
-func NewManager(cfg *config.Config, aiClient *ai.Client, notifier notifier.Sender) *Manager {
-	return &Manager{
-		cfg:          cfg,
-		aiClient:     aiClient,
-		notifier:     notifier,
-		msgChan:      make(chan model.MessageData, 1000),
-		windowBuffer: make(map[int64][]model.MessageData),
+const translatedLegend = "注：附有“原文”的消息已翻译，引用时可同时给出译文与原文\n\n"
+
+const channelLegend = "注：以下为频道帖子，👁 为阅读数，↗ 为转发数，可据此判断传播程度\n\n"
+
+const globalSummaryBanner = "\n====== GLOBAL INTELLIGENCE SUMMARY ======\nModel: %s/%s\n%s\n========================================="
+
+// globalSummaryTitle heads the delivered global summary
+const globalSummaryTitle = "Global Summary"
+
+// partialSummaryNote marks a summary whose stream aborted midway
+const partialSummaryNote = "\n\n⚠️ 生成中断，以上为部分内容"
+
+// windowCheckInterval is how often group windows are checked for completion
+const windowCheckInterval = 5 * time.Second
+
+// deliveryTimeout bounds sending a finished summary
+const deliveryTimeout = 30 * time.Second
+
+// deliveryContext gives sending a summary its own deadline, so a summary that
+// finished just as the shutdown deadline passed is still delivered
+func deliveryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), deliveryTimeout)
+}
+
+// callsEvaluateInterval is how often calls are checked for elapsed horizons
+const callsEvaluateInterval = time.Minute
+
+// NewManager builds the analyzer, costs may be nil to leave usage untracked
+func NewManager(cfg *config.Config, aiClient *ai.Client, notifier notifier.Sender, store *store.Store, costs *cost.Tracker) (*Manager, error) {
+	m := &Manager{
+		cfg:            cfg,
+		aiClient:       aiClient,
+		notifier:       notifier,
+		pipeline:       preprocess.NewPipeline(cfg),
+		store:          store,
+		cost:           costs,
+		msgChan:        make(chan model.MessageData, 1000),
+		trigger:        make(chan struct{}, 1),
+		windowBuffer:   make(map[int64][]model.MessageData),
+		windowStart:    make(map[int64]time.Time),
+		sources:        make(map[int64]string),
+		paused:         make(map[int64]bool),
+		filterStats:    make(map[int64]preprocess.Stats),
+		languageStats:  make(map[int64]map[string]int),
+		pendingTickers: make(map[string]tickerCount),
+	}
+
+	source, err := market.NewSource(cfg)
+	if err != nil {
+		return nil, err
+	}
+	m.prices = source
+
+	metrics.QueueCapacity.Set(float64(cap(m.msgChan)))
+
+	if cfg.Reputation.Enabled {
+		tracker, err := reputation.NewTracker(cfg)
+		if err != nil {
+			return nil, err
+		}
+		m.reputation = tracker
 	}
+
+	if cfg.Calls.Enabled {
+		tracker, err := calls.NewTracker(cfg, source)
+		if err != nil {
+			return nil, err
+		}
+		m.calls = tracker
+	}
+
+	if cfg.Translate.Enabled {
+		m.translator = translate.NewTranslator(cfg, aiClient)
+	}
+
+	if cfg.Cluster.Enabled {
+		tracker, err := cluster.NewTracker(cfg)
+		if err != nil {
+			return nil, err
+		}
+		m.stories = tracker
+	}
+
+	return m, nil
 }
 
 // AddMessage queues a message for analysis
 func (m *Manager) AddMessage(msg model.MessageData) {
+	group := metrics.Group(msg.GroupID)
+	metrics.MessagesReceived.WithLabelValues(group).Inc()
+	metrics.LastMessageTimestamp.SetToCurrentTime()
+	if !m.accepting(group) {
+		return
+	}
+
 	select {
 	case m.msgChan <- msg:
 	default:
+		metrics.MessagesDropped.WithLabelValues(group, "queue_full").Inc()
 		m.debugf("[WARN] Message queue full, dropping message")
 	}
 }
 
-// Start runs the main analysis loop
+// Start runs the main analysis loop until ctx is cancelled, then flushes the
+// buffered windows before returning. Analysis runs detached from ctx so a
+// call in flight when the shutdown starts is allowed to finish.
 func (m *Manager) Start(ctx context.Context) {
+	work := context.WithoutCancel(ctx)
 	windowDuration := time.Duration(m.cfg.Monitor.WindowSeconds) * time.Second
+	checkInterval := min(windowCheckInterval, windowDuration)
+
+	m.mu.Lock()
+	m.epoch = time.Now()
+	m.lastSummary = m.epoch
+	m.mu.Unlock()
+
+	if err := m.restoreBuffer(m.epoch); err != nil {
+		log.Printf("Restoring buffered messages failed: %v", err)
+	}
+
 	ticker := time.NewTicker(windowDuration)
 	defer ticker.Stop()
+	checker := time.NewTicker(checkInterval)
+	defer checker.Stop()
+
+	// Calls are evaluated apart from ingestion, pricing them may take a
+	// request per call and horizon
+	var evaluator sync.WaitGroup
+	if m.calls != nil {
+		evaluator.Go(func() { m.evaluateCalls(ctx) })
+	}
 
 	log.Printf("Analyzer started, monitor window: %v", windowDuration)
 
 	for {
 		select {
 		case msg := <-m.msgChan:
-			m.mu.Lock()
-			m.windowBuffer[msg.GroupID] = append(m.windowBuffer[msg.GroupID], msg)
-			m.mu.Unlock()
+			m.archive(work, msg)
+			m.addToWindow(msg, time.Now())
+
+		case now := <-checker.C:
+			m.analyzeDueGroups(work, now, false)
+			m.updateGauges()
 
-		case <-ticker.C:
-			m.analyzeAndPrint(ctx, windowDuration)
+		case now := <-ticker.C:
+			// Flush groups on the global boundary before summarizing
+			m.analyzeDueGroups(work, now, false)
+			m.analyzeAndPrint(work, windowDuration, now)
+
+		case <-m.trigger:
+			now := time.Now()
+			log.Printf("Immediate analysis triggered")
+			m.analyzeDueGroups(work, now, true)
+			m.analyzeAndPrint(work, windowDuration, now)
 
 		case <-ctx.Done():
+			evaluator.Wait()
+			m.shutdown(work, windowDuration)
 			return
 		}
 	}
 }
 
-func (m *Manager) analyzeAndPrint(ctx context.Context, window time.Duration) {
+// evaluateCalls prices calls and their elapsed horizons until ctx is
+// cancelled. Live price sources only know the present, so horizons are
+// priced shortly after they pass.
+func (m *Manager) evaluateCalls(ctx context.Context) {
+	ticker := time.NewTicker(callsEvaluateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			m.calls.Evaluate(ctx, now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// addToWindow buffers a message, realigning the window of a group that was idle
+func (m *Manager) addToWindow(msg model.MessageData, now time.Time) {
 	m.mu.Lock()
-	currentBatch := m.windowBuffer
-	m.windowBuffer = make(map[int64][]model.MessageData)
+	defer m.mu.Unlock()
+
+	if m.paused[msg.GroupID] {
+		metrics.MessagesDropped.WithLabelValues(metrics.Group(msg.GroupID), "paused").Inc()
+		return
+	}
+
+	if msg.Source != "" {
+		m.sources[msg.GroupID] = msg.Source
+	}
+	if len(m.windowBuffer[msg.GroupID]) == 0 {
+		window := m.settings(msg.GroupID).Window()
+		start, ok := m.windowStart[msg.GroupID]
+		if !ok {
+			start = m.epoch
+			m.windowStart[msg.GroupID] = start
+		}
+		if elapsed := now.Sub(start); elapsed >= window {
+			m.windowStart[msg.GroupID] = start.Add(window * (elapsed / window))
+		}
+	}
+	buffer := m.windowBuffer[msg.GroupID]
+	if !msg.Late {
+		m.windowBuffer[msg.GroupID] = append(buffer, msg)
+		return
+	}
+
+	// Late messages go to their place in time, those from a window that was
+	// already analyzed stay at the front and are labelled in the chat log.
+	// A long recovery would flood the window, so their number is bounded.
+	metrics.MessagesLate.WithLabelValues(metrics.Group(msg.GroupID)).Inc()
+	late := 0
+	for _, buffered := range buffer {
+		if buffered.Late {
+			late++
+		}
+	}
+	if late >= m.cfg.Monitor.MaxLateMessages {
+		metrics.MessagesDropped.WithLabelValues(metrics.Group(msg.GroupID), "late").Inc()
+		return
+	}
+	i := sort.Search(len(buffer), func(i int) bool { return buffer[i].Timestamp.After(msg.Timestamp) })
+	m.windowBuffer[msg.GroupID] = slices.Insert(buffer, i, msg)
+}
+
+// analyzeDueGroups analyzes every group whose window has elapsed and which
+// meets its activity thresholds (or has waited longer than its max wait).
+// force analyzes every buffered group regardless.
+func (m *Manager) analyzeDueGroups(ctx context.Context, now time.Time, force bool) {
+	type dueGroup struct {
+		settings config.GroupConfig
+		messages []model.MessageData
+		start    time.Time
+	}
+
+	var due []dueGroup
+	m.mu.Lock()
+	for groupID, msgs := range m.windowBuffer {
+		settings := m.settings(groupID)
+		window := settings.Window()
+
+		start, ok := m.windowStart[groupID]
+		if !ok {
+			start = m.epoch
+		}
+		elapsed := now.Sub(start)
+		if elapsed < window && !force {
+			continue
+		}
+
+		if len(msgs) > 0 && !force && !meetsThresholds(settings, msgs) {
+			switch {
+			case len(msgs) >= m.cfg.Monitor.MaxHeldMessages:
+				m.debugf("Group %d: %d messages held, analyzing anyway", groupID, len(msgs))
+			case settings.MaxWait() == 0 || elapsed < settings.MaxWait():
+				m.debugf("Group %d: %d messages below threshold, holding window", groupID, len(msgs))
+				continue
+			default:
+				m.debugf("Group %d: max wait %v exceeded, analyzing anyway", groupID, settings.MaxWait())
+			}
+		}
+
+		// Advance by whole windows to stay aligned with the global boundary
+		m.windowStart[groupID] = start.Add(window * (elapsed / window))
+		delete(m.windowBuffer, groupID)
+		if len(msgs) > 0 {
+			due = append(due, dueGroup{settings: settings, messages: msgs, start: start})
+		}
+	}
 	m.mu.Unlock()
 
-	if len(currentBatch) == 0 {
+	if len(due) == 0 {
 		return
 	}
 
-	m.debugf("--- Monitor Report for past %v ---", window)
+	overBudget := m.applyBudget(ctx, now)
 
+	// Reports reach the global summary in group order whichever finishes first
+	sort.Slice(due, func(i, j int) bool { return due[i].settings.ID < due[j].settings.ID })
+	reports := make([]string, len(due))
 	var wg sync.WaitGroup
-	var summaries []string
-	var summariesMu sync.Mutex
-
-	for groupID, msgs := range currentBatch {
-		wg.Add(1)
-		go func(gid int64, messages []model.MessageData) {
-			defer wg.Done()
-			summary := m.processGroupBatch(ctx, gid, messages)
-			if summary != "" {
-				summariesMu.Lock()
-				summaries = append(summaries, formatGroupReport(gid, summary))
-				summariesMu.Unlock()
+	for i, g := range due {
+		if overBudget && m.cfg.Cost.SkipLowPriority && g.settings.Priority == config.PriorityLow {
+			log.Printf("Group %d: over budget, skipping low priority window of %d messages", g.settings.ID, len(g.messages))
+			continue
+		}
+
+		analyze := func() {
+			result := m.processGroupBatch(ctx, g.settings, g.messages, g.start, now)
+			if result.Content == "" {
+				// Keep a window cut short by the shutdown deadline for the next start
+				if ctx.Err() != nil {
+					m.requeue(g.settings.ID, g.messages)
+				}
+				return
 			}
-		}(groupID, msgs)
+			reports[i] = formatGroupReport(g.settings.ID, sourceOf(g.messages), result.Content)
+
+			m.saveReport(ctx, &store.Report{
+				GroupID:      g.settings.ID,
+				Content:      result.Content,
+				Provider:     result.Provider,
+				Model:        result.Model,
+				MessageCount: len(g.messages),
+				WindowStart:  g.start,
+				WindowEnd:    now,
+			})
+		}
+		if m.serial {
+			analyze()
+		} else {
+			wg.Go(analyze)
+		}
 	}
 	wg.Wait()
 
-	if len(summaries) > 0 {
-		m.processGlobalSummary(ctx, summaries)
+	m.mu.Lock()
+	for _, report := range reports {
+		if report != "" {
+			m.pendingReports = append(m.pendingReports, report)
+		}
 	}
+	m.mu.Unlock()
 
+	if m.reputation != nil {
+		if err := m.reputation.Save(); err != nil {
+			log.Printf("Reputation save failed: %v", err)
+		}
+	}
+	if m.calls != nil {
+		if err := m.calls.Save(now); err != nil {
+			log.Printf("Calls save failed: %v", err)
+		}
+	}
+}
+
+func (m *Manager) analyzeAndPrint(ctx context.Context, window time.Duration, now time.Time) {
+	m.mu.Lock()
+	summaries := m.pendingReports
+	tickers := m.pendingTickers
+	msgs := m.pendingMessages
+	start := m.lastSummary
+	m.pendingReports = nil
+	m.pendingTickers = make(map[string]tickerCount)
+	m.pendingMessages = nil
+	m.lastSummary = now
+	m.mu.Unlock()
+
+	if len(summaries) == 0 {
+		return
+	}
+
+	m.debugf("--- Monitor Report for past %v ---", window)
+	topics := m.topicContext(ctx, msgs, start, now)
+	if result := m.processGlobalSummary(ctx, summaries, topics, tickers, start, now); result.Content != "" {
+		m.saveReport(ctx, &store.Report{
+			GroupID:      store.GlobalGroupID,
+			Content:      result.Content,
+			Provider:     result.Provider,
+			Model:        result.Model,
+			MessageCount: len(summaries),
+			WindowStart:  start,
+			WindowEnd:    now,
+		})
+	}
 	m.debugf("---------------------------")
 }
 
-func (m *Manager) processGlobalSummary(ctx context.Context, summaries []string) {
+// archive keeps the raw message when message archiving is enabled
+func (m *Manager) archive(ctx context.Context, msg model.MessageData) {
+	if m.store == nil || !m.cfg.Storage.Messages {
+		return
+	}
+	if err := m.store.SaveMessage(ctx, msg); err != nil {
+		log.Printf("Message archive failed: %v", err)
+	}
+}
+
+// archiveEngagement updates the archived copies of a window's messages with
+// the engagement gathered until analysis, later changes are not archived
+func (m *Manager) archiveEngagement(ctx context.Context, msgs []model.MessageData) {
+	if m.store == nil || !m.cfg.Storage.Messages {
+		return
+	}
+	if err := m.store.UpdateEngagement(ctx, msgs); err != nil {
+		log.Printf("Message engagement archive failed: %v", err)
+	}
+}
+
+// saveReport persists a report when storage is configured
+func (m *Manager) saveReport(ctx context.Context, report *store.Report) {
+	if m.reportDir != "" {
+		if err := writeReportFile(m.reportDir, report); err != nil {
+			log.Printf("Report write failed: %v", err)
+		}
+	}
+	if m.store == nil {
+		return
+	}
+	if err := m.store.SaveReport(ctx, report); err != nil {
+		log.Printf("Report save failed: %v", err)
+	}
+}
+
+func (m *Manager) processGlobalSummary(ctx context.Context, summaries []string, topics string, tickers map[string]tickerCount, windowStart, windowEnd time.Time) ai.Result {
+	start := time.Now()
+	defer func() {
+		metrics.GlobalSummaryDuration.Observe(time.Since(start).Seconds())
+	}()
+
 	combinedReport := strings.Join(summaries, "\n\n---\n\n")
+	if topics != "" {
+		combinedReport = topics + "\n\n---\n\n" + combinedReport
+	}
+	if marketContext := m.marketContext(ctx, tickers, windowEnd); marketContext != "" {
+		combinedReport += "\n\n---\n\n" + marketContext
+	}
 
 	m.debugf("Generating Global Summary...")
 
-	ctxWithTimeout, cancel := context.WithTimeout(ctx, 45*time.Second)
-	defer cancel()
+	// Post a placeholder and fill it in as the summary streams in
+	var draft notifier.Draft
+	if drafter, ok := m.notifier.(notifier.Drafter); ok {
+		d, err := drafter.Draft(ctx, globalSummaryTitle+"\n⏳ 生成中...")
+		if err != nil {
+			log.Printf("Notifier draft failed: %v", err)
+		} else {
+			draft = d
+		}
+	}
+	onDelta := func(content string) {
+		if draft == nil {
+			return
+		}
+		if err := draft.Update(ctx, globalSummaryTitle+"\n"+content); err != nil {
+			m.debugf("Notifier draft update failed: %v", err)
+		}
+	}
 
-	summary, err := m.aiClient.AnalyzeSummary(ctxWithTimeout, combinedReport)
+	// The AI client applies a timeout to each model it tries
+	result, err := m.aiClient.AnalyzeSummaryStream(ctx, combinedReport, onDelta)
 	if err != nil {
-		log.Printf("Global summary failed: %v", err)
-		return
+		if result.Content == "" {
+			log.Printf("Global summary failed: %v", err)
+			if draft != nil {
+				sendCtx, cancel := deliveryContext(ctx)
+				if err := draft.Finish(sendCtx, globalSummaryTitle+"\n❌ 生成失败"); err != nil {
+					log.Printf("Notifier send failed: %v", err)
+				}
+				cancel()
+			}
+			return ai.Result{}
+		}
+		// Keep what was generated before the stream aborted
+		log.Printf("Global summary interrupted, keeping partial output: %v", err)
+		result.Content += partialSummaryNote
 	}
+	m.recordUsage(ctx, store.GlobalGroupID, ai.StageSummary, result, windowStart, windowEnd)
 
-	log.Printf(globalSummaryBanner, summary)
-	if m.notifier != nil {
-		if err := m.notifier.Send(ctx, fmt.Sprintf("Global Summary:\n%s", summary)); err != nil {
-			log.Printf("Notifier send failed: %v", err)
-		}
+	log.Printf(globalSummaryBanner, result.Provider, result.Model, result.Content)
+	text := fmt.Sprintf("%s (%s/%s):\n%s", globalSummaryTitle, result.Provider, result.Model, result.Content)
+	sendCtx, cancel := deliveryContext(ctx)
+	defer cancel()
+	var sendErr error
+	if draft != nil {
+		sendErr = draft.Finish(sendCtx, text)
+	} else if m.notifier != nil {
+		sendErr = m.notifier.Send(sendCtx, text)
 	}
+	if sendErr != nil {
+		log.Printf("Notifier send failed: %v", sendErr)
+	}
+	return result
 }
 
-func (m *Manager) processGroupBatch(ctx context.Context, groupID int64, msgs []model.MessageData) string {
+func (m *Manager) processGroupBatch(ctx context.Context, settings config.GroupConfig, msgs []model.MessageData, windowStart, windowEnd time.Time) ai.Result {
+	groupID := settings.ID
+
 	// Simple stats
 	m.debugf("Group %d: %d messages", groupID, len(msgs))
 
 	// 1. Preprocessing
+	msgs, removed := m.pipeline.Run(msgs)
+	m.recordFilterStats(groupID, removed)
+	if removed.Total() > 0 {
+		m.debugf("Group %d: filtered %d messages %v", groupID, removed.Total(), removed)
+	}
+
+	m.refreshEngagement(ctx, groupID, msgs)
+	countReplies(msgs)
+	m.archiveEngagement(ctx, msgs)
+
+	languages := preprocess.LanguageMix(msgs)
+	m.recordLanguages(groupID, languages)
+	if m.translator != nil {
+		for _, result := range m.translator.Translate(ctx, msgs) {
+			m.recordUsage(ctx, groupID, ai.StageTranslate, result, windowStart, windowEnd)
+		}
+	}
+
+	if m.calls != nil {
+		m.calls.Record(ctx, msgs)
+	}
+	m.countTickers(msgs)
+	m.collectForClustering(msgs)
+
+	var firstMentions []reputation.FirstMention
+	if m.reputation != nil {
+		firstMentions = m.reputation.Observe(groupID, msgs)
+		if m.cfg.Reputation.OrderChatLog {
+			// Put high-reputation senders first, keeping each sender's messages in order
+			sort.SliceStable(msgs, func(i, j int) bool {
+				return m.reputation.Score(groupID, reputation.SenderKey(msgs[i])) > m.reputation.Score(groupID, reputation.SenderKey(msgs[j]))
+			})
+		}
+	}
+
 	var chatLogBuilder strings.Builder
 	messageCount := 0
+	highSignal := false
+	translated := false
+	engaged := false
+	channel := sourceOf(msgs) == model.SourceChannel
 	for _, msg := range msgs {
-		if len([]rune(msg.Text)) < 2 {
-			continue
+		// Translated messages keep their original so reports can quote both
+		text := msg.Text
+		if msg.Translation != "" {
+			text = fmt.Sprintf("%s ｜原文[%s]: %s", msg.Translation, msg.Lang, msg.Text)
+			translated = true
+		}
+		if msg.Late && msg.Timestamp.Before(windowStart) {
+			text = fmt.Sprintf("[补录 %s] %s", msg.Timestamp.Local().Format("01-02 15:04"), text)
+		}
+
+		tag := engagementTag(msg)
+		if tag != "" {
+			engaged = true
 		}
-		// Include sender ID for accurate unique counts
-		if msg.SenderID != 0 {
-			chatLogBuilder.WriteString(fmt.Sprintf("- U%d: %s\n", msg.SenderID, msg.Text))
+
+		// Channel posts all come from the channel, their reach matters instead
+		if channel {
+			chatLogBuilder.WriteString(fmt.Sprintf("- 📢 (👁 %d ↗ %d)%s: %s\n", msg.Views, msg.Forwards, tag, text))
+		} else if m.reputation != nil && m.reputation.HighSignal(groupID, reputation.SenderKey(msg)) {
+			chatLogBuilder.WriteString(fmt.Sprintf("- U%d★%s: %s\n", msg.SenderID, tag, text))
+			highSignal = true
+		} else if msg.SenderID != 0 {
+			chatLogBuilder.WriteString(fmt.Sprintf("- U%d%s: %s\n", msg.SenderID, tag, text))
 		} else {
-			chatLogBuilder.WriteString(fmt.Sprintf("- U?: %s\n", msg.Text))
+			chatLogBuilder.WriteString(fmt.Sprintf("- U?%s: %s\n", tag, text))
 		}
 		messageCount++
 	}
 
 	if messageCount == 0 {
 		m.debugf("Group %d: No valid discussion", groupID)
-		return ""
+		return ai.Result{}
 	}
 
 	chatLog := chatLogBuilder.String()
+	if engaged {
+		chatLog = engagementLegend + chatLog
+	}
+	if channel {
+		chatLog = channelLegend + chatLog
+	}
+	if highSignal {
+		chatLog = highSignalLegend + chatLog
+	}
+	if translated {
+		chatLog = translatedLegend + chatLog
+	}
 	m.debugf("[DEBUG] Group %d text to analyze:\n%s\n", groupID, chatLog)
 
-	// 2. Call LLM for analysis
-	// Set timeout
-	ctxWithTimeout, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
-
-	analysis, err := m.aiClient.Analyze(ctxWithTimeout, chatLog)
+	// 2. Call LLM for analysis, the AI client times out and fails over per model
+	result, err := m.aiClient.Analyze(ctx, settings.PromptProfile, chatLog)
 	if err != nil {
 		log.Printf("Group %d LLM analysis failed: %v", groupID, err)
-		return ""
+		return ai.Result{}
+	}
+	m.recordUsage(ctx, groupID, ai.StageGroup, result, windowStart, windowEnd)
+	log.Printf("Group %d analyzed by %s/%s", groupID, result.Provider, result.Model)
+
+	m.debugf(">>> Group %d Analysis Result:\n%s\n", groupID, result.Content)
+	result.Content += m.highSignalNotes(groupID, firstMentions)
+	if len(languages) > 1 {
+		result.Content += "\n\n🌐 语言分布：" + preprocess.FormatLanguageMix(languages)
+	}
+	return result
+}
+
+// highSignalNotes lists tickers whose first mention in the window came from a high-signal user
+func (m *Manager) highSignalNotes(groupID int64, firsts []reputation.FirstMention) string {
+	var b strings.Builder
+	for _, first := range firsts {
+		if !m.reputation.HighSignal(groupID, first.Sender) {
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteString("\n\n⭐ 高信号用户首提：")
+		}
+		b.WriteString(fmt.Sprintf("\n• %s ← %s (评分 %.2f)", first.Ticker, reputation.Label(first.Sender), first.Score))
+	}
+	return b.String()
+}
+
+func (m *Manager) recordFilterStats(groupID int64, removed preprocess.Stats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats, ok := m.filterStats[groupID]
+	if !ok {
+		stats = make(preprocess.Stats)
+		m.filterStats[groupID] = stats
+	}
+	stats.Add(removed)
+
+	group := metrics.Group(groupID)
+	for filter, n := range removed {
+		metrics.MessagesFiltered.WithLabelValues(group, filter).Add(float64(n))
+	}
+}
+
+func (m *Manager) recordLanguages(groupID int64, mix map[string]int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats, ok := m.languageStats[groupID]
+	if !ok {
+		stats = make(map[string]int)
+		m.languageStats[groupID] = stats
 	}
+	group := metrics.Group(groupID)
+	for lang, n := range mix {
+		stats[lang] += n
+		metrics.MessagesByLanguage.WithLabelValues(group, lang).Add(float64(n))
+	}
+}
+
+// updateGauges publishes queue occupancy and window buffer sizes
+func (m *Manager) updateGauges() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	m.debugf(">>> Group %d Analysis Result:\n%s\n", groupID, analysis)
-	return analysis
+	metrics.QueueLength.Set(float64(len(m.msgChan)))
+	for groupID := range m.windowStart {
+		metrics.WindowBuffer.WithLabelValues(metrics.Group(groupID)).Set(float64(len(m.windowBuffer[groupID])))
+	}
+}
+
+// FilterStats returns a snapshot of messages removed per filter for each group
+func (m *Manager) FilterStats() map[int64]preprocess.Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := make(map[int64]preprocess.Stats, len(m.filterStats))
+	for groupID, stats := range m.filterStats {
+		copied := make(preprocess.Stats, len(stats))
+		copied.Add(stats)
+		snapshot[groupID] = copied
+	}
+	return snapshot
 }
 
 func (m *Manager) debugf(format string, args ...any) {
@@ -176,6 +741,45 @@ func (m *Manager) debugf(format string, args ...any) {
 	}
 }
 
-func formatGroupReport(groupID int64, summary string) string {
-	return fmt.Sprintf("Group %d Report:\n%s", groupID, summary)
+func formatGroupReport(groupID int64, source, summary string) string {
+	switch source {
+	case model.SourceChannel:
+		return fmt.Sprintf("Channel %d Report:\n%s", groupID, summary)
+	case model.SourceDM:
+		return fmt.Sprintf("Direct Messages U%d Report:\n%s", -groupID, summary)
+	default:
+		return fmt.Sprintf("Group %d Report:\n%s", groupID, summary)
+	}
+}
+
+// settings resolves the settings of a group for the kind of chat it is,
+// m.mu must be held
+func (m *Manager) settings(groupID int64) config.GroupConfig {
+	return m.cfg.SourceSettings(groupID, m.sources[groupID])
+}
+
+// sourceOf returns the kind of chat a window's messages come from
+func sourceOf(msgs []model.MessageData) string {
+	for _, msg := range msgs {
+		if msg.Source != "" {
+			return msg.Source
+		}
+	}
+	return ""
+}
+
+// meetsThresholds reports whether a window has enough activity to be worth an LLM call
+func meetsThresholds(settings config.GroupConfig, msgs []model.MessageData) bool {
+	if len(msgs) < settings.MinMessages {
+		return false
+	}
+	// Channels have a single sender, only the number of posts counts
+	if sourceOf(msgs) == model.SourceChannel {
+		return true
+	}
+	senders := make(map[int64]struct{})
+	for _, msg := range msgs {
+		senders[msg.SenderID] = struct{}{}
+	}
+	return len(senders) >= settings.MinSenders
 }
@@ -0,0 +1,80 @@
+package analyzer
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/ai"
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+)
+
+// newTestManager loads the replay config, which analyzes with the mock provider
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	out := t.TempDir()
+	t.Chdir(filepath.Join("testdata", "replay"))
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Reputation.Enabled = false
+	cfg.Calls.Enabled = false
+	cfg.Cluster.Enabled = false
+	cfg.Monitor.PendingFile = filepath.Join(out, "pending.jsonl")
+
+	m, err := NewManager(cfg, ai.NewClient(cfg), nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestHeldWindowCap(t *testing.T) {
+	m := newTestManager(t)
+	m.cfg.Monitor.MinSenders = 3
+	m.cfg.Monitor.MaxHeldMessages = 4
+
+	const groupID = 1
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	m.epoch = start
+	buffer := func(n int) {
+		for i := range n {
+			m.windowBuffer[groupID] = append(m.windowBuffer[groupID], model.MessageData{
+				GroupID: groupID, SenderID: 10, Text: "still just me", Timestamp: start.Add(time.Duration(i) * time.Second),
+			})
+		}
+	}
+
+	// One sender never meets min_senders and max_wait is off, the window is held
+	buffer(3)
+	m.analyzeDueGroups(context.Background(), start.Add(time.Minute), false)
+	if got := len(m.windowBuffer[groupID]); got != 3 {
+		t.Fatalf("buffer after holding = %d, want 3", got)
+	}
+
+	buffer(1)
+	m.analyzeDueGroups(context.Background(), start.Add(2*time.Minute), false)
+	if _, ok := m.windowBuffer[groupID]; ok {
+		t.Fatal("window at max_held_messages is still held")
+	}
+	if len(m.pendingReports) != 1 {
+		t.Errorf("pending reports = %d, want the capped window analyzed", len(m.pendingReports))
+	}
+}
+
+func TestGroupOverrideZero(t *testing.T) {
+	m := newTestManager(t)
+	m.cfg.Monitor.MinSenders = 3
+	zero := 0
+	m.cfg.Monitor.Groups = []config.GroupOverride{{ID: 1, MinSenders: &zero}, {ID: 2}}
+
+	if got := m.cfg.GroupSettings(1).MinSenders; got != 0 {
+		t.Errorf("group set to 0 min senders = %d, want 0", got)
+	}
+	if got := m.cfg.GroupSettings(2).MinSenders; got != 3 {
+		t.Errorf("group without override min senders = %d, want the default 3", got)
+	}
+}
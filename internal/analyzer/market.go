@@ -0,0 +1,90 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/entity"
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+)
+
+// tickerCount is the mentions of a ticker since the last global summary,
+// and their total weight by engagement
+type tickerCount struct {
+	mentions int
+	weight   float64
+}
+
+// countTickers adds the window's ticker mentions to the pending global counts
+func (m *Manager) countTickers(msgs []model.MessageData) {
+	if m.prices == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, msg := range msgs {
+		for _, ticker := range entity.Extract(msg.Text).Tickers {
+			count := m.pendingTickers[ticker]
+			count.mentions++
+			count.weight += msg.Weight()
+			m.pendingTickers[ticker] = count
+		}
+	}
+}
+
+// marketContext quotes the most discussed tickers as of now so the summary
+// can ground price claims. Mentions are ranked by engagement weight.
+func (m *Manager) marketContext(ctx context.Context, tickers map[string]tickerCount, now time.Time) string {
+	if m.prices == nil || len(tickers) == 0 {
+		return ""
+	}
+
+	ranked := make([]string, 0, len(tickers))
+	for ticker := range tickers {
+		ranked = append(ranked, ticker)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if tickers[ranked[i]].weight != tickers[ranked[j]].weight {
+			return tickers[ranked[i]].weight > tickers[ranked[j]].weight
+		}
+		return ranked[i] < ranked[j]
+	})
+
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var b strings.Builder
+	quoted := 0
+	for _, ticker := range ranked {
+		if quoted >= m.cfg.Market.TopTickers {
+			break
+		}
+		quote, err := m.prices.Quote(ctxWithTimeout, ticker, now)
+		if err != nil {
+			m.debugf("Market quote for %s failed: %v", ticker, err)
+			continue
+		}
+		if quoted == 0 {
+			b.WriteString("行情参考（按提及与互动热度排序的代币）：\n")
+		}
+		b.WriteString(fmt.Sprintf("• %s 价格 %s | 1h %+.2f%% | 24h %+.2f%% | %d次提及\n",
+			ticker, formatPrice(quote.Price), quote.Change1h, quote.Change24h, tickers[ticker].mentions))
+		quoted++
+	}
+
+	if quoted > 0 {
+		m.debugf("Attached market context for %d tickers", quoted)
+	}
+	return b.String()
+}
+
+func formatPrice(price float64) string {
+	if price >= 1 {
+		return fmt.Sprintf("%.2f", price)
+	}
+	return fmt.Sprintf("%.6g", price)
+}
@@ -0,0 +1,98 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+	"github.com/FuradWho/TgRadar-Go/internal/store"
+)
+
+// WriteReportsTo additionally writes every report as a file in dir
+func (m *Manager) WriteReportsTo(dir string) {
+	m.reportDir = dir
+}
+
+// Replay runs recorded messages through the analyzer on a simulated clock
+// driven by their timestamps. Window checks and global summaries fire at the
+// same boundaries Start would use, and whatever is still buffered after the
+// last message is flushed on the following boundary. Groups are analyzed
+// one at a time so the same input always gives the same reports.
+func (m *Manager) Replay(ctx context.Context, msgs []model.MessageData) {
+	if len(msgs) == 0 {
+		return
+	}
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return msgs[i].Timestamp.Before(msgs[j].Timestamp)
+	})
+	m.serial = true
+
+	windowDuration := time.Duration(m.cfg.Monitor.WindowSeconds) * time.Second
+	checkInterval := min(windowCheckInterval, windowDuration)
+
+	m.mu.Lock()
+	m.epoch = msgs[0].Timestamp
+	m.lastSummary = m.epoch
+	m.mu.Unlock()
+
+	nextCheck := m.epoch.Add(checkInterval)
+	nextTick := m.epoch.Add(windowDuration)
+
+	// advance fires every check and tick up to and including until
+	advance := func(until time.Time) {
+		for !nextCheck.After(until) || !nextTick.After(until) {
+			if nextCheck.Before(nextTick) {
+				m.analyzeDueGroups(ctx, nextCheck, false)
+				nextCheck = nextCheck.Add(checkInterval)
+				continue
+			}
+			if nextCheck.Equal(nextTick) {
+				nextCheck = nextCheck.Add(checkInterval)
+			}
+			m.analyzeDueGroups(ctx, nextTick, false)
+			if m.calls != nil {
+				m.calls.Evaluate(ctx, nextTick)
+			}
+			m.analyzeAndPrint(ctx, windowDuration, nextTick)
+			nextTick = nextTick.Add(windowDuration)
+		}
+	}
+
+	for _, msg := range msgs {
+		if ctx.Err() != nil {
+			return
+		}
+		advance(msg.Timestamp)
+		m.addToWindow(msg, msg.Timestamp)
+	}
+
+	m.analyzeDueGroups(ctx, nextTick, true)
+	m.analyzeAndPrint(ctx, windowDuration, nextTick)
+}
+
+// writeReportFile writes a report to dir, named by window end and group so
+// replays of the same input produce the same files
+func writeReportFile(dir string, r *store.Report) error {
+	name := "global"
+	title := "Global Summary"
+	if r.GroupID != store.GlobalGroupID {
+		name = fmt.Sprintf("group_%d", r.GroupID)
+		title = fmt.Sprintf("Group %d", r.GroupID)
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("# %s\n\n", title))
+	b.WriteString(fmt.Sprintf("- Window: %s ~ %s\n", r.WindowStart.UTC().Format(time.RFC3339), r.WindowEnd.UTC().Format(time.RFC3339)))
+	b.WriteString(fmt.Sprintf("- Messages: %d\n", r.MessageCount))
+	b.WriteString(fmt.Sprintf("- Model: %s/%s\n\n", r.Provider, r.Model))
+	b.WriteString(r.Content)
+	b.WriteString("\n")
+
+	path := filepath.Join(dir, fmt.Sprintf("%s_%s.md", r.WindowEnd.UTC().Format("20060102T150405Z"), name))
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
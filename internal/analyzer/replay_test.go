@@ -0,0 +1,171 @@
+package analyzer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/FuradWho/TgRadar-Go/internal/ai"
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// TestReplayGolden replays testdata/replay/messages.jsonl with the mock
+// provider and fixture prices and compares every report to the golden files
+func TestReplayGolden(t *testing.T) {
+	dir, err := filepath.Abs(filepath.Join("testdata", "replay"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join(dir, "golden")
+	out := t.TempDir()
+
+	// LoadConfig reads config.yml from the working directory
+	t.Chdir(dir)
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Storage.Path = ""
+	cfg.Reputation.File = filepath.Join(out, "reputation.json")
+	cfg.Calls.File = filepath.Join(out, "calls.json")
+	cfg.Cluster.File = filepath.Join(out, "stories.json")
+
+	m, err := NewManager(cfg, ai.NewClient(cfg), nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports := filepath.Join(out, "reports")
+	if err := os.MkdirAll(reports, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	m.WriteReportsTo(reports)
+	m.Replay(context.Background(), readTestMessages(t, filepath.Join(dir, "messages.jsonl")))
+
+	got := readReports(t, reports)
+	if len(got) == 0 {
+		t.Fatal("replay wrote no reports")
+	}
+	if *update {
+		if err := os.RemoveAll(golden); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(golden, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range got {
+			if err := os.WriteFile(filepath.Join(golden, name), []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return
+	}
+
+	want := readReports(t, golden)
+	for _, name := range sortedNames(want) {
+		if _, ok := got[name]; !ok {
+			t.Errorf("report %s missing", name)
+		} else if got[name] != want[name] {
+			t.Errorf("report %s differs from golden file:\n--- got ---\n%s\n--- want ---\n%s", name, got[name], want[name])
+		}
+	}
+	for _, name := range sortedNames(got) {
+		if _, ok := want[name]; !ok {
+			t.Errorf("unexpected report %s, run with -update to accept it", name)
+		}
+	}
+}
+
+// TestReplayDeterministic replays the same messages twice and expects
+// identical reports
+func TestReplayDeterministic(t *testing.T) {
+	dir, err := filepath.Abs(filepath.Join("testdata", "replay"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+	msgs := readTestMessages(t, filepath.Join(dir, "messages.jsonl"))
+
+	var runs []map[string]string
+	for range 2 {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := t.TempDir()
+		cfg.Storage.Path = ""
+		cfg.Reputation.File = filepath.Join(out, "reputation.json")
+		cfg.Calls.File = filepath.Join(out, "calls.json")
+		cfg.Cluster.File = filepath.Join(out, "stories.json")
+
+		m, err := NewManager(cfg, ai.NewClient(cfg), nil, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.WriteReportsTo(out)
+		m.Replay(context.Background(), slices.Clone(msgs))
+		runs = append(runs, readReports(t, out))
+	}
+	for name, content := range runs[0] {
+		if runs[1][name] != content {
+			t.Errorf("report %s differs between runs", name)
+		}
+	}
+}
+
+func readTestMessages(t *testing.T, path string) []model.MessageData {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var msgs []model.MessageData
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var msg model.MessageData
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, msg)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return msgs
+}
+
+// readReports returns the markdown reports in dir by file name
+func readReports(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports := make(map[string]string, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reports[filepath.Base(path)] = string(data)
+	}
+	return reports
+}
+
+func sortedNames(reports map[string]string) []string {
+	names := make([]string, 0, len(reports))
+	for name := range reports {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,144 @@
+package analyzer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/metrics"
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+)
+
+// shutdown stops ingestion, drains the queue and runs a final analysis of
+// everything buffered. Messages whose analysis has not finished when the
+// shutdown deadline passes are persisted and restored on the next start.
+func (m *Manager) shutdown(ctx context.Context, window time.Duration) {
+	m.closing.Store(true)
+
+	drained := 0
+	for draining := true; draining; {
+		select {
+		case msg := <-m.msgChan:
+			m.archive(ctx, msg)
+			m.addToWindow(msg, time.Now())
+			drained++
+		default:
+			draining = false
+		}
+	}
+	log.Printf("Shutting down, drained %d queued messages, running final analysis", drained)
+
+	timeout := time.Duration(m.cfg.Monitor.ShutdownTimeoutSeconds) * time.Second
+	flushCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	now := time.Now()
+	m.analyzeDueGroups(flushCtx, now, true)
+	if m.calls != nil {
+		m.calls.Evaluate(flushCtx, now)
+	}
+	m.analyzeAndPrint(flushCtx, window, now)
+
+	if flushCtx.Err() != nil {
+		log.Printf("Final analysis did not finish within %v", timeout)
+	}
+	if err := m.persistBuffer(); err != nil {
+		log.Printf("Persisting buffered messages failed: %v", err)
+	}
+	log.Printf("Analyzer stopped")
+}
+
+// requeue puts back the messages of a window whose analysis was cut short
+func (m *Manager) requeue(groupID int64, msgs []model.MessageData) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.windowBuffer[groupID] = append(msgs, m.windowBuffer[groupID]...)
+}
+
+// persistBuffer writes whatever is still buffered to the pending file
+func (m *Manager) persistBuffer() error {
+	m.mu.Lock()
+	var msgs []model.MessageData
+	for _, buffered := range m.windowBuffer {
+		msgs = append(msgs, buffered...)
+	}
+	m.mu.Unlock()
+
+	if len(msgs) == 0 || m.cfg.Monitor.PendingFile == "" {
+		return nil
+	}
+	sort.SliceStable(msgs, func(i, j int) bool { return msgs[i].Timestamp.Before(msgs[j].Timestamp) })
+
+	tmp := m.cfg.Monitor.PendingFile + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, msg := range msgs {
+		if err := enc.Encode(msg); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, m.cfg.Monitor.PendingFile); err != nil {
+		return err
+	}
+	log.Printf("Persisted %d unanalyzed messages to %s", len(msgs), m.cfg.Monitor.PendingFile)
+	return nil
+}
+
+// restoreBuffer buffers the messages persisted by the previous shutdown
+func (m *Manager) restoreBuffer(now time.Time) error {
+	path := m.cfg.Monitor.PendingFile
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	restored := 0
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var msg model.MessageData
+		if err := dec.Decode(&msg); err != nil {
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+		m.addToWindow(msg, now)
+		restored++
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	log.Printf("Restored %d messages left unanalyzed by the last shutdown", restored)
+	return nil
+}
+
+// accepting reports whether new messages are still taken in
+func (m *Manager) accepting(group string) bool {
+	if m.closing.Load() {
+		metrics.MessagesDropped.WithLabelValues(group, "shutting_down").Inc()
+		return false
+	}
+	return true
+}
@@ -0,0 +1,160 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/FuradWho/TgRadar-Go/internal/ai"
+	"github.com/FuradWho/TgRadar-Go/internal/cluster"
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+	"github.com/FuradWho/TgRadar-Go/internal/store"
+)
+
+// embedBatch is how many messages are embedded per request
+const embedBatch = 128
+
+// sampleRunes truncates topic samples in the summary input
+const sampleRunes = 80
+
+// collectForClustering keeps a group's filtered messages for the next global
+// summary, dropping the oldest beyond cluster.max_messages
+func (m *Manager) collectForClustering(msgs []model.MessageData) {
+	if m.stories == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, msg := range msgs {
+		if strings.TrimSpace(msg.Text) != "" {
+			m.pendingMessages = append(m.pendingMessages, msg)
+		}
+	}
+	if limit := m.cfg.Cluster.MaxMessages; limit > 0 && len(m.pendingMessages) > limit {
+		m.pendingMessages = slices.Delete(m.pendingMessages, 0, len(m.pendingMessages)-limit)
+	}
+}
+
+// topicContext clusters the window's messages across groups and renders the
+// topics with their exact message, participant and group counts
+func (m *Manager) topicContext(ctx context.Context, msgs []model.MessageData, start, now time.Time) string {
+	if m.stories == nil || len(msgs) == 0 {
+		return ""
+	}
+
+	vectors := m.storedEmbeddings(ctx, msgs, start, now)
+	var missing []int
+	var texts []string
+	for i, msg := range msgs {
+		if vectors[i] != nil {
+			continue
+		}
+		missing = append(missing, i)
+		texts = append(texts, clusterText(msg))
+	}
+	for first := 0; first < len(texts); first += embedBatch {
+		last := min(first+embedBatch, len(texts))
+		batch, result, err := m.aiClient.Embed(ctx, texts[first:last])
+		if err != nil {
+			log.Printf("Topic clustering skipped, embedding failed: %v", err)
+			return ""
+		}
+		m.recordUsage(ctx, store.GlobalGroupID, ai.StageEmbedding, result, start, now)
+		if len(batch) != last-first {
+			log.Printf("Topic clustering skipped, got %d embeddings for %d messages", len(batch), last-first)
+			return ""
+		}
+		for j, vector := range batch {
+			vectors[missing[first+j]] = vector
+		}
+	}
+	m.debugf("Topic clustering reused %d stored embeddings", len(msgs)-len(missing))
+
+	topics := m.stories.Update(msgs, vectors, now)
+	if err := m.stories.Save(now); err != nil {
+		log.Printf("Stories save failed: %v", err)
+	}
+	m.debugf("Clustered %d messages into %d topics", len(msgs), len(topics))
+	return formatTopics(topics)
+}
+
+// clusterText is what a message is embedded as. Translations are clustered
+// so the same topic in different languages matches.
+func clusterText(msg model.MessageData) string {
+	if msg.Translation != "" {
+		return msg.Translation
+	}
+	return msg.Text
+}
+
+// storedEmbeddings looks up vectors the search indexer already computed for
+// msgs, leaving nil where there is none for the text being clustered
+func (m *Manager) storedEmbeddings(ctx context.Context, msgs []model.MessageData, from, to time.Time) [][]float32 {
+	vectors := make([][]float32, len(msgs))
+	embeddingModel := m.aiClient.EmbeddingModel()
+	if m.store == nil || !m.cfg.Storage.Messages || embeddingModel == "" {
+		return vectors
+	}
+	// Windows are buffered before they are analyzed, so look a window further back
+	from = from.Add(-time.Duration(m.cfg.Monitor.WindowSeconds) * time.Second)
+	stored, err := m.store.EmbeddingsBetween(ctx, embeddingModel, from, to)
+	if err != nil {
+		log.Printf("Loading stored embeddings failed: %v", err)
+		return vectors
+	}
+	for i, msg := range msgs {
+		if e, ok := stored[store.MessageKey{GroupID: msg.GroupID, MsgID: msg.MsgID}]; ok && e.Text == clusterText(msg) {
+			vectors[i] = e.Vector
+		}
+	}
+	return vectors
+}
+
+// Stories returns the stories followed across windows, nil when clustering is off
+func (m *Manager) Stories() []cluster.Story {
+	if m.stories == nil {
+		return nil
+	}
+	return m.stories.Stories()
+}
+
+func formatTopics(topics []cluster.Topic) string {
+	if len(topics) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("话题聚类（跨群语义聚类，消息数、人数、群数与互动数为精确统计，按讨论人数与互动热度排序）：\n")
+	for _, t := range topics {
+		status := "新话题"
+		if !t.New {
+			status = fmt.Sprintf("持续话题，第%d个窗口", t.Windows)
+		}
+		b.WriteString(fmt.Sprintf("• 话题#%d %s（%s）｜%d条消息 · %d人讨论 · %d个群",
+			t.StoryID, t.Title, status, t.Messages, t.Participants, len(t.Groups)))
+		if t.Engagement > 0 {
+			b.WriteString(fmt.Sprintf(" · %d次互动", t.Engagement))
+		}
+		b.WriteString("\n")
+		if len(t.Symbols) > 0 {
+			b.WriteString(fmt.Sprintf("  相关：%s\n", strings.Join(t.Symbols[:min(5, len(t.Symbols))], ", ")))
+		}
+		for _, msg := range t.Samples {
+			text := msg.Text
+			if msg.Translation != "" {
+				text = msg.Translation
+			}
+			text = strings.Join(strings.Fields(text), " ")
+			if utf8.RuneCountInString(text) > sampleRunes {
+				text = string([]rune(text)[:sampleRunes]) + "…"
+			}
+			b.WriteString(fmt.Sprintf("  - %s\n", text))
+		}
+	}
+	return b.String()
+}
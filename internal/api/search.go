@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/search"
+	"github.com/FuradWho/TgRadar-Go/internal/store"
+)
+
+// handleSearch searches archived messages:
+// ?q=&group=&sender=&entity=&from=&to=&limit=&mode=semantic
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if s.searcher == nil {
+		writeError(w, http.StatusServiceUnavailable, "search needs storage.messages")
+		return
+	}
+
+	params := r.URL.Query()
+	q := search.Query{
+		Text:     params.Get("q"),
+		Semantic: params.Get("mode") == "semantic",
+	}
+	if v := params.Get("entity"); v != "" {
+		q.Entity = search.NormalizeEntity(v)
+	}
+
+	var err error
+	for name, dest := range map[string]*int64{"group": &q.GroupID, "sender": &q.SenderID} {
+		if v := params.Get(name); v != "" {
+			if *dest, err = strconv.ParseInt(v, 10, 64); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid "+name)
+				return
+			}
+		}
+	}
+	if v := params.Get("from"); v != "" {
+		if q.From, err = search.ParseTime(v); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid from, expected RFC 3339 or YYYY-MM-DD")
+			return
+		}
+	}
+	if v := params.Get("to"); v != "" {
+		if q.To, err = search.ParseTime(v); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid to, expected RFC 3339 or YYYY-MM-DD")
+			return
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+	}
+
+	hits, err := s.searcher.Search(r.Context(), q)
+	if errors.Is(err, search.ErrSemanticDisabled) || errors.Is(err, search.ErrOverBudget) {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if hits == nil {
+		hits = []store.MessageHit{}
+	}
+	writeJSON(w, http.StatusOK, hits)
+}
+
+type askRequest struct {
+	Question string    `json:"question"`
+	Group    int64     `json:"group"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+}
+
+// handleAsk answers a question from archived messages and reports, body
+// {"question": "...", "group": <id>, "from": <RFC 3339>, "to": <RFC 3339>}
+func (s *Server) handleAsk(w http.ResponseWriter, r *http.Request) {
+	if s.searcher == nil {
+		writeError(w, http.StatusServiceUnavailable, "ask needs storage.messages")
+		return
+	}
+
+	var req askRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Question == "" {
+		writeError(w, http.StatusBadRequest, "question is required")
+		return
+	}
+
+	answer, err := s.searcher.Ask(r.Context(), req.Question, store.MessageFilter{
+		GroupID: req.Group,
+		From:    req.From,
+		To:      req.To,
+	})
+	if errors.Is(err, search.ErrOverBudget) {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, answer)
+}
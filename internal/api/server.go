@@ -0,0 +1,273 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/analyzer"
+	"github.com/FuradWho/TgRadar-Go/internal/cluster"
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/FuradWho/TgRadar-Go/internal/cost"
+	"github.com/FuradWho/TgRadar-Go/internal/metrics"
+	"github.com/FuradWho/TgRadar-Go/internal/search"
+	"github.com/FuradWho/TgRadar-Go/internal/store"
+	"github.com/FuradWho/TgRadar-Go/internal/telegram"
+)
+
+const (
+	defaultReportLimit = 20
+	maxReportLimit     = 200
+)
+
+// Radar is the part of the analyzer the API controls
+type Radar interface {
+	Groups() []analyzer.GroupStatus
+	Status() analyzer.Status
+	TriggerAnalysis()
+	Pause(groupID int64)
+	Resume(groupID int64)
+	CostTotals(ctx context.Context) (cost.Totals, error)
+	Stories() []cluster.Story
+}
+
+// Connection reports the state of the Telegram connections
+type Connection interface {
+	Status() []telegram.ConnectionStatus
+}
+
+// statusResponse adds the connection state of every account to the analyzer status
+type statusResponse struct {
+	analyzer.Status
+	Telegram []telegram.ConnectionStatus `json:"telegram,omitempty"`
+}
+
+// Server exposes reports, stats and control over HTTP with bearer token auth
+type Server struct {
+	cfg      *config.Config
+	radar    Radar
+	store    *store.Store
+	searcher *search.Searcher
+	conn     Connection
+	mux      *http.ServeMux
+}
+
+func NewServer(cfg *config.Config, radar Radar, store *store.Store, searcher *search.Searcher, conn Connection) *Server {
+	s := &Server{
+		cfg:      cfg,
+		radar:    radar,
+		store:    store,
+		searcher: searcher,
+		conn:     conn,
+		mux:      http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("GET /api/groups", s.handleGroups)
+	s.mux.HandleFunc("GET /api/groups/{id}/reports", s.handleReports)
+	s.mux.HandleFunc("GET /api/groups/{id}/reports/latest", s.handleLatestReport)
+	s.mux.HandleFunc("POST /api/groups/{id}/pause", s.handlePause)
+	s.mux.HandleFunc("POST /api/groups/{id}/resume", s.handleResume)
+	s.mux.HandleFunc("GET /api/reports/global", s.handleReports)
+	s.mux.HandleFunc("GET /api/reports/global/latest", s.handleLatestReport)
+	s.mux.HandleFunc("GET /api/status", s.handleStatus)
+	s.mux.HandleFunc("POST /api/analyze", s.handleAnalyze)
+	s.mux.HandleFunc("GET /api/cost", s.handleCost)
+	s.mux.HandleFunc("GET /api/search", s.handleSearch)
+	s.mux.HandleFunc("GET /api/stories", s.handleStories)
+	s.mux.HandleFunc("POST /api/ask", s.handleAsk)
+	// Metrics label series with group IDs, so they need the token like the rest
+	s.mux.Handle("GET /metrics", metrics.Handler())
+
+	return s
+}
+
+// Handler returns the authenticated API handler
+func (s *Server) Handler() http.Handler {
+	return s.authenticate(s.mux)
+}
+
+// Start serves until ctx is cancelled
+func (s *Server) Start(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:              s.cfg.API.Listen,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("API listening on %s", s.cfg.API.Listen)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	expected := []byte("Bearer " + s.cfg.API.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, expected) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleGroups(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.radar.Groups())
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	resp := statusResponse{Status: s.radar.Status()}
+	if s.conn != nil {
+		resp.Telegram = s.conn.Status()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleAnalyze(w http.ResponseWriter, r *http.Request) {
+	s.radar.TriggerAnalysis()
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "triggered"})
+}
+
+func (s *Server) handleCost(w http.ResponseWriter, r *http.Request) {
+	totals, err := s.radar.CostTotals(r.Context())
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, totals)
+}
+
+func (s *Server) handleStories(w http.ResponseWriter, r *http.Request) {
+	stories := s.radar.Stories()
+	if stories == nil {
+		stories = []cluster.Story{}
+	}
+	writeJSON(w, http.StatusOK, stories)
+}
+
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := groupParam(w, r)
+	if !ok {
+		return
+	}
+	s.radar.Pause(groupID)
+	writeJSON(w, http.StatusOK, map[string]any{"id": groupID, "paused": true})
+}
+
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := groupParam(w, r)
+	if !ok {
+		return
+	}
+	s.radar.Resume(groupID)
+	writeJSON(w, http.StatusOK, map[string]any{"id": groupID, "paused": false})
+}
+
+// handleReports lists reports newest first, paging with ?before=<RFC 3339>&limit=<n>
+func (s *Server) handleReports(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := reportGroup(w, r)
+	if !ok || !s.requireStore(w) {
+		return
+	}
+
+	limit := defaultReportLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = min(n, maxReportLimit)
+	}
+
+	var before time.Time
+	if v := r.URL.Query().Get("before"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid before, expected RFC 3339")
+			return
+		}
+		before = t
+	}
+
+	reports, err := s.store.Reports(r.Context(), groupID, before, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if reports == nil {
+		reports = []store.Report{}
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
+
+func (s *Server) handleLatestReport(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := reportGroup(w, r)
+	if !ok || !s.requireStore(w) {
+		return
+	}
+
+	report, err := s.store.LatestReport(r.Context(), groupID)
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "no reports yet")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (s *Server) requireStore(w http.ResponseWriter) bool {
+	if s.store == nil {
+		writeError(w, http.StatusServiceUnavailable, "report storage is disabled")
+		return false
+	}
+	return true
+}
+
+// reportGroup resolves the group of a report route, global routes have no {id}
+func reportGroup(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	if strings.HasPrefix(r.URL.Path, "/api/reports/global") {
+		return store.GlobalGroupID, true
+	}
+	return groupParam(w, r)
+}
+
+func groupParam(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	groupID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || groupID == store.GlobalGroupID {
+		writeError(w, http.StatusBadRequest, "invalid group id")
+		return 0, false
+	}
+	return groupID, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("API response encode failed: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/analyzer"
+	"github.com/FuradWho/TgRadar-Go/internal/cluster"
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/FuradWho/TgRadar-Go/internal/cost"
+	"github.com/FuradWho/TgRadar-Go/internal/store"
+)
+
+const testToken = "secret"
+
+// fakeRadar records the control calls it receives
+type fakeRadar struct {
+	groups    []analyzer.GroupStatus
+	triggered int
+	paused    []int64
+	resumed   []int64
+}
+
+func (f *fakeRadar) Groups() []analyzer.GroupStatus { return f.groups }
+func (f *fakeRadar) Status() analyzer.Status        { return analyzer.Status{Groups: f.groups} }
+func (f *fakeRadar) TriggerAnalysis()               { f.triggered++ }
+func (f *fakeRadar) Pause(groupID int64)            { f.paused = append(f.paused, groupID) }
+func (f *fakeRadar) Resume(groupID int64)           { f.resumed = append(f.resumed, groupID) }
+func (f *fakeRadar) Stories() []cluster.Story       { return nil }
+
+func (f *fakeRadar) CostTotals(context.Context) (cost.Totals, error) {
+	return cost.Totals{}, nil
+}
+
+func newTestServer(t *testing.T, radar Radar, st *store.Store) http.Handler {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.API.Token = testToken
+	return NewServer(cfg, radar, st, nil, nil).Handler()
+}
+
+func openTestStore(t *testing.T) *store.Store {
+	t.Helper()
+	st, err := store.Open(filepath.Join(t.TempDir(), "radar.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+// do sends an authenticated request and decodes a JSON response into out
+func do(t *testing.T, h http.Handler, method, path string, out any) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if out != nil && rec.Code < 300 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decode %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func TestAuthentication(t *testing.T) {
+	h := newTestServer(t, &fakeRadar{}, nil)
+	for _, tc := range []struct {
+		name, header string
+		want         int
+	}{
+		{"missing", "", http.StatusUnauthorized},
+		{"wrong", "Bearer wrong", http.StatusUnauthorized},
+		{"no scheme", testToken, http.StatusUnauthorized},
+		{"valid", "Bearer " + testToken, http.StatusOK},
+	} {
+		for _, path := range []string{"/api/groups", "/metrics"} {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Errorf("%s token on %s = %d, want %d", tc.name, path, rec.Code, tc.want)
+			}
+			if tc.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("%s token on %s has no WWW-Authenticate challenge", tc.name, path)
+			}
+		}
+	}
+}
+
+func TestGroups(t *testing.T) {
+	radar := &fakeRadar{groups: []analyzer.GroupStatus{{ID: -100, Buffered: 3}, {ID: -200, Paused: true}}}
+	h := newTestServer(t, radar, nil)
+
+	var groups []analyzer.GroupStatus
+	if code := do(t, h, http.MethodGet, "/api/groups", &groups); code != http.StatusOK {
+		t.Fatalf("GET /api/groups = %d", code)
+	}
+	if len(groups) != 2 || groups[0].Buffered != 3 || !groups[1].Paused {
+		t.Errorf("groups = %+v", groups)
+	}
+}
+
+func TestReports(t *testing.T) {
+	ctx := context.Background()
+	st := openTestStore(t)
+	h := newTestServer(t, &fakeRadar{}, st)
+
+	if code := do(t, h, http.MethodGet, "/api/groups/-100/reports/latest", nil); code != http.StatusNotFound {
+		t.Errorf("latest before any report = %d, want 404", code)
+	}
+
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, content := range []string{"first", "second", "third"} {
+		err := st.SaveReport(ctx, &store.Report{GroupID: -100, Content: content, CreatedAt: base.Add(time.Duration(i) * time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.SaveReport(ctx, &store.Report{GroupID: store.GlobalGroupID, Content: "global", CreatedAt: base}); err != nil {
+		t.Fatal(err)
+	}
+
+	var latest store.Report
+	if code := do(t, h, http.MethodGet, "/api/groups/-100/reports/latest", &latest); code != http.StatusOK || latest.Content != "third" {
+		t.Errorf("latest = %d %q, want 200 third", code, latest.Content)
+	}
+
+	var reports []store.Report
+	if code := do(t, h, http.MethodGet, "/api/groups/-100/reports?limit=2", &reports); code != http.StatusOK {
+		t.Fatalf("reports = %d", code)
+	}
+	if got := contents(reports); !slices.Equal(got, []string{"third", "second"}) {
+		t.Errorf("reports = %v, want newest first", got)
+	}
+
+	before := base.Add(90 * time.Minute).Format(time.RFC3339)
+	if code := do(t, h, http.MethodGet, "/api/groups/-100/reports?before="+before, &reports); code != http.StatusOK {
+		t.Fatalf("reports before = %d", code)
+	}
+	if got := contents(reports); !slices.Equal(got, []string{"second", "first"}) {
+		t.Errorf("reports before %s = %v", before, got)
+	}
+
+	if code := do(t, h, http.MethodGet, "/api/reports/global/latest", &latest); code != http.StatusOK || latest.Content != "global" {
+		t.Errorf("global latest = %d %q, want 200 global", code, latest.Content)
+	}
+
+	for _, path := range []string{
+		"/api/groups/abc/reports",
+		"/api/groups/0/reports/latest",
+		"/api/groups/-100/reports?limit=0",
+		"/api/groups/-100/reports?before=yesterday",
+	} {
+		if code := do(t, h, http.MethodGet, path, nil); code != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want 400", path, code)
+		}
+	}
+}
+
+func TestReportsWithoutStore(t *testing.T) {
+	h := newTestServer(t, &fakeRadar{}, nil)
+	if code := do(t, h, http.MethodGet, "/api/groups/-100/reports", nil); code != http.StatusServiceUnavailable {
+		t.Errorf("reports without storage = %d, want 503", code)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	radar := &fakeRadar{groups: []analyzer.GroupStatus{{ID: -100}}}
+	h := newTestServer(t, radar, nil)
+
+	// A group not seen yet can be paused ahead of its first message
+	var resp struct {
+		ID     int64 `json:"id"`
+		Paused bool  `json:"paused"`
+	}
+	if code := do(t, h, http.MethodPost, "/api/groups/-999/pause", &resp); code != http.StatusOK || resp.ID != -999 || !resp.Paused {
+		t.Errorf("pause unknown group = %d %+v", code, resp)
+	}
+	if code := do(t, h, http.MethodPost, "/api/groups/-999/resume", &resp); code != http.StatusOK || resp.Paused {
+		t.Errorf("resume unknown group = %d %+v", code, resp)
+	}
+	if !slices.Equal(radar.paused, []int64{-999}) || !slices.Equal(radar.resumed, []int64{-999}) {
+		t.Errorf("paused %v resumed %v, want -999 each", radar.paused, radar.resumed)
+	}
+
+	if code := do(t, h, http.MethodPost, "/api/groups/0/pause", nil); code != http.StatusBadRequest {
+		t.Errorf("pause global group = %d, want 400", code)
+	}
+	if code := do(t, h, http.MethodGet, "/api/groups/-100/pause", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET pause = %d, want 405", code)
+	}
+	if len(radar.paused) != 1 {
+		t.Errorf("rejected requests paused groups %v", radar.paused)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	radar := &fakeRadar{}
+	h := newTestServer(t, radar, nil)
+
+	var resp map[string]string
+	if code := do(t, h, http.MethodPost, "/api/analyze", &resp); code != http.StatusAccepted || resp["status"] != "triggered" {
+		t.Errorf("analyze = %d %v, want 202 triggered", code, resp)
+	}
+	if radar.triggered != 1 {
+		t.Errorf("triggered %d times, want 1", radar.triggered)
+	}
+	if code := do(t, h, http.MethodGet, "/api/analyze", nil); code != http.StatusMethodNotAllowed || radar.triggered != 1 {
+		t.Errorf("GET analyze = %d, triggered %d", code, radar.triggered)
+	}
+}
+
+func contents(reports []store.Report) []string {
+	var out []string
+	for _, r := range reports {
+		out = append(out, r.Content)
+	}
+	return out
+}
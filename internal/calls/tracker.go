@@ -0,0 +1,338 @@
+package calls
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/FuradWho/TgRadar-Go/internal/entity"
+	"github.com/FuradWho/TgRadar-Go/internal/market"
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+)
+
+// Call is a single ticker or contract mention and what the price did afterwards
+type Call struct {
+	Symbol   string    `json:"symbol"`
+	GroupID  int64     `json:"group_id"`
+	SenderID int64     `json:"sender_id"`
+	MsgID    int       `json:"msg_id"`
+	Time     time.Time `json:"time"`
+	// First call of the symbol in the group within the cooldown
+	First      bool    `json:"first"`
+	EntryPrice float64 `json:"entry_price"`
+	// Time the entry price is from, horizons are measured from it. Live
+	// sources quote the present, which may be a while after the call.
+	PriceTime time.Time `json:"price_time,omitzero"`
+	// The source had no price for the symbol
+	NoPrice bool `json:"no_price,omitempty"`
+	// Forward returns in percent keyed by horizon in minutes
+	Returns map[int]float64 `json:"returns,omitempty"`
+	// Horizons in minutes whose price was not known in time
+	Missed []int `json:"missed,omitempty"`
+}
+
+// liveSlack is how late a horizon may be evaluated from a live source, whose
+// quotes are the present price rather than the price at the horizon
+const liveSlack = 10 * time.Minute
+
+// Tracker records calls and computes their forward returns
+type Tracker struct {
+	path      string
+	source    market.PriceSource
+	horizons  []time.Duration
+	cooldown  time.Duration
+	retention time.Duration
+	calls     []*Call
+	mu        sync.Mutex
+}
+
+// NewTracker loads recorded calls from the configured file, a missing file starts empty
+func NewTracker(cfg *config.Config, source market.PriceSource) (*Tracker, error) {
+	cc := cfg.Calls
+	t := &Tracker{
+		path:      cc.File,
+		source:    source,
+		cooldown:  time.Duration(cc.CooldownHours) * time.Hour,
+		retention: time.Duration(cc.RetentionDays) * 24 * time.Hour,
+	}
+	for _, minutes := range cc.HorizonMinutes {
+		t.horizons = append(t.horizons, time.Duration(minutes)*time.Minute)
+	}
+	// Evaluate stops at the first horizon still ahead
+	slices.Sort(t.horizons)
+
+	data, err := os.ReadFile(t.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read calls file: %w", err)
+	}
+	if err := json.Unmarshal(data, &t.calls); err != nil {
+		return nil, fmt.Errorf("parse calls file: %w", err)
+	}
+	return t, nil
+}
+
+// Record extracts calls from a window of messages. Historical sources price
+// them right away, calls on live sources are priced by the next Evaluate so
+// no request holds up the analysis.
+func (t *Tracker) Record(ctx context.Context, msgs []model.MessageData) {
+	historical := t.source != nil && market.Historical(t.source)
+	for _, msg := range msgs {
+		if msg.SenderID == 0 {
+			continue
+		}
+		for _, symbol := range entity.Extract(msg.Text).Symbols() {
+			call, ok := t.newCall(symbol, msg)
+			if !ok {
+				continue
+			}
+			if historical {
+				t.priceEntry(ctx, call)
+			}
+
+			t.mu.Lock()
+			t.calls = append(t.calls, call)
+			t.mu.Unlock()
+		}
+	}
+}
+
+// priceEntry snapshots the entry price of a call, failed lookups other than
+// a missing price are retried by the next Evaluate
+func (t *Tracker) priceEntry(ctx context.Context, call *Call) {
+	quote, err := t.source.Quote(ctx, call.Symbol, call.Time)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case err == nil:
+		call.EntryPrice, call.PriceTime = quote.Price, call.Time
+		if !market.Historical(t.source) {
+			call.PriceTime = quote.Time
+		}
+	case errors.Is(err, market.ErrNoPrice):
+		call.NoPrice = true
+	default:
+		log.Printf("Price lookup for %s failed: %v", call.Symbol, err)
+	}
+}
+
+// entryTime is when the entry price is from, the call time for calls
+// recorded before it was kept
+func (c *Call) entryTime() time.Time {
+	if c.PriceTime.IsZero() {
+		return c.Time
+	}
+	return c.PriceTime
+}
+
+// newCall builds a call unless the sender already called the symbol in this group within the cooldown
+func (t *Tracker) newCall(symbol string, msg model.MessageData) (*Call, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	call := &Call{
+		Symbol:   symbol,
+		GroupID:  msg.GroupID,
+		SenderID: msg.SenderID,
+		MsgID:    msg.MsgID,
+		Time:     msg.Timestamp,
+		First:    true,
+	}
+
+	// Groups are recorded concurrently, so calls are not strictly ordered by time
+	cutoff := msg.Timestamp.Add(-t.cooldown)
+	for _, prev := range t.calls {
+		if prev.Symbol != symbol || prev.GroupID != msg.GroupID || prev.Time.Before(cutoff) {
+			continue
+		}
+		if prev.SenderID == msg.SenderID {
+			return nil, false
+		}
+		if !prev.Time.After(msg.Timestamp) {
+			call.First = false
+		}
+	}
+	return call, true
+}
+
+// Evaluate prices new calls on live sources and fills in forward returns
+// for every horizon that has elapsed by now. Calls on a live source not
+// priced within liveSlack are given up, and a horizon more than liveSlack in
+// the past is marked missed, as only the present price could be looked up.
+func (t *Tracker) Evaluate(ctx context.Context, now time.Time) {
+	if t.source == nil {
+		return
+	}
+	historical := market.Historical(t.source)
+
+	t.mu.Lock()
+	var unpriced, pending []*Call
+	for _, call := range t.calls {
+		switch {
+		case call.NoPrice:
+		case call.EntryPrice == 0:
+			unpriced = append(unpriced, call)
+		case len(call.Returns)+len(call.Missed) < len(t.horizons):
+			pending = append(pending, call)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, call := range unpriced {
+		if !historical && now.Sub(call.Time) > liveSlack {
+			t.mu.Lock()
+			call.NoPrice = true
+			t.mu.Unlock()
+			continue
+		}
+		t.priceEntry(ctx, call)
+		t.mu.Lock()
+		priced := call.EntryPrice != 0
+		t.mu.Unlock()
+		if priced {
+			pending = append(pending, call)
+		}
+	}
+
+	for _, call := range pending {
+		t.mu.Lock()
+		entry := call.entryTime()
+		t.mu.Unlock()
+
+		for _, horizon := range t.horizons {
+			key := int(horizon / time.Minute)
+			at := entry.Add(horizon)
+			if now.Before(at) {
+				break
+			}
+
+			t.mu.Lock()
+			_, done := call.Returns[key]
+			done = done || slices.Contains(call.Missed, key)
+			if !done && !historical && now.Sub(at) > liveSlack {
+				call.Missed = append(call.Missed, key)
+				done = true
+			}
+			t.mu.Unlock()
+			if done {
+				continue
+			}
+
+			quote, err := t.source.Quote(ctx, call.Symbol, at)
+			if err != nil {
+				continue
+			}
+
+			t.mu.Lock()
+			if call.Returns == nil {
+				call.Returns = make(map[int]float64)
+			}
+			call.Returns[key] = (quote.Price/call.EntryPrice - 1) * 100
+			t.mu.Unlock()
+		}
+	}
+}
+
+// Save drops calls past retention and persists the rest atomically
+func (t *Tracker) Save(now time.Time) error {
+	t.mu.Lock()
+	if t.retention > 0 {
+		cutoff := now.Add(-t.retention)
+		kept := t.calls[:0]
+		for _, call := range t.calls {
+			if call.Time.After(cutoff) {
+				kept = append(kept, call)
+			}
+		}
+		t.calls = kept
+	}
+	data, err := json.Marshal(t.calls)
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write calls file: %w", err)
+	}
+	return os.Rename(tmp, t.path)
+}
+
+// Leaderboard dimensions
+const (
+	BySender = "sender"
+	ByGroup  = "group"
+)
+
+// Entry is one row of a leaderboard
+type Entry struct {
+	ID        int64
+	Calls     int
+	AvgReturn float64
+	WinRate   float64
+}
+
+// Leaderboard ranks senders or groups by the average return of their first
+// calls at the given horizon, only calls with a known return count
+func (t *Tracker) Leaderboard(by string, horizon time.Duration, limit int) []Entry {
+	key := int(horizon / time.Minute)
+
+	type agg struct {
+		calls int
+		sum   float64
+		wins  int
+	}
+	byID := make(map[int64]*agg)
+
+	t.mu.Lock()
+	for _, call := range t.calls {
+		ret, ok := call.Returns[key]
+		if !call.First || !ok {
+			continue
+		}
+		id := call.SenderID
+		if by == ByGroup {
+			id = call.GroupID
+		}
+		a, ok := byID[id]
+		if !ok {
+			a = &agg{}
+			byID[id] = a
+		}
+		a.calls++
+		a.sum += ret
+		if ret > 0 {
+			a.wins++
+		}
+	}
+	t.mu.Unlock()
+
+	entries := make([]Entry, 0, len(byID))
+	for id, a := range byID {
+		entries = append(entries, Entry{
+			ID:        id,
+			Calls:     a.calls,
+			AvgReturn: a.sum / float64(a.calls),
+			WinRate:   float64(a.wins) / float64(a.calls),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].AvgReturn > entries[j].AvgReturn
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
@@ -0,0 +1,208 @@
+package calls
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/FuradWho/TgRadar-Go/internal/market"
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+)
+
+var t0 = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+const testPrices = `symbol,time,price
+BTC,2025-03-01T12:00:00Z,100
+BTC,2025-03-01T13:00:00Z,110
+BTC,2025-03-01T16:00:00Z,90
+ETH,2025-03-01T12:00:00Z,10
+ETH,2025-03-01T13:00:00Z,12
+`
+
+func newTestTracker(t *testing.T, source market.PriceSource) *Tracker {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Calls.File = filepath.Join(t.TempDir(), "calls.json")
+	// Out of order on purpose, the tracker sorts them
+	cfg.Calls.HorizonMinutes = []int{240, 60}
+	cfg.Calls.CooldownHours = 24
+	tracker, err := NewTracker(cfg, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tracker
+}
+
+func fixtureSource(t *testing.T) market.PriceSource {
+	t.Helper()
+	source, err := market.ParseFixture(strings.NewReader(testPrices))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return source
+}
+
+func message(groupID, senderID int64, text string, at time.Time) model.MessageData {
+	return model.MessageData{GroupID: groupID, SenderID: senderID, Text: text, Timestamp: at}
+}
+
+func TestRecordFirstCallerAndCooldown(t *testing.T) {
+	tracker := newTestTracker(t, fixtureSource(t))
+	tracker.Record(context.Background(), []model.MessageData{
+		message(1, 10, "$BTC to the moon", t0),
+		message(1, 20, "aping $BTC too", t0.Add(time.Minute)),
+		// Within the cooldown of the same sender and group
+		message(1, 10, "$BTC again", t0.Add(5*time.Minute)),
+		// Another group has its own first caller
+		message(2, 20, "$BTC", t0.Add(2*time.Minute)),
+		// No sender, such as an anonymous post
+		message(1, 0, "$BTC", t0),
+	})
+
+	if len(tracker.calls) != 3 {
+		t.Fatalf("recorded %d calls, want 3", len(tracker.calls))
+	}
+	want := []struct {
+		group, sender int64
+		first         bool
+	}{{1, 10, true}, {1, 20, false}, {2, 20, true}}
+	for i, w := range want {
+		call := tracker.calls[i]
+		if call.GroupID != w.group || call.SenderID != w.sender || call.First != w.first {
+			t.Errorf("call %d = group %d sender %d first %v, want group %d sender %d first %v",
+				i, call.GroupID, call.SenderID, call.First, w.group, w.sender, w.first)
+		}
+		if call.EntryPrice != 100 {
+			t.Errorf("call %d entry price = %v, want 100", i, call.EntryPrice)
+		}
+	}
+}
+
+func TestRecordCooldownExpires(t *testing.T) {
+	tracker := newTestTracker(t, fixtureSource(t))
+	tracker.Record(context.Background(), []model.MessageData{
+		message(1, 10, "$BTC", t0),
+		message(1, 10, "$BTC", t0.Add(25*time.Hour)),
+	})
+	if len(tracker.calls) != 2 {
+		t.Fatalf("recorded %d calls, want 2 once the cooldown passed", len(tracker.calls))
+	}
+	if !tracker.calls[1].First {
+		t.Error("call after the cooldown is not first")
+	}
+}
+
+func TestEvaluateReturns(t *testing.T) {
+	ctx := context.Background()
+	tracker := newTestTracker(t, fixtureSource(t))
+	tracker.Record(ctx, []model.MessageData{
+		message(1, 10, "$BTC", t0),
+		message(1, 20, "$ETH", t0),
+		message(1, 30, "$DOGE", t0),
+	})
+
+	tracker.Evaluate(ctx, t0.Add(61*time.Minute))
+	btc, eth, doge := tracker.calls[0], tracker.calls[1], tracker.calls[2]
+	if got := btc.Returns[60]; math.Abs(got-10) > 1e-9 {
+		t.Errorf("BTC 60m return = %v, want 10", got)
+	}
+	if _, ok := btc.Returns[240]; ok {
+		t.Error("BTC 240m return filled in before the horizon")
+	}
+	if got := eth.Returns[60]; math.Abs(got-20) > 1e-9 {
+		t.Errorf("ETH 60m return = %v, want 20", got)
+	}
+	if !doge.NoPrice || doge.Returns != nil {
+		t.Errorf("DOGE without prices = %+v, want no price and no returns", doge)
+	}
+
+	tracker.Evaluate(ctx, t0.Add(5*time.Hour))
+	if got := btc.Returns[240]; math.Abs(got+10) > 1e-9 {
+		t.Errorf("BTC 240m return = %v, want -10", got)
+	}
+	if len(btc.Missed) != 0 {
+		t.Errorf("historical source missed horizons %v", btc.Missed)
+	}
+}
+
+func TestLeaderboard(t *testing.T) {
+	ctx := context.Background()
+	tracker := newTestTracker(t, fixtureSource(t))
+	tracker.Record(ctx, []model.MessageData{
+		message(1, 10, "$BTC", t0),
+		message(1, 20, "$BTC", t0.Add(time.Minute)),
+		message(2, 20, "$ETH", t0),
+	})
+	tracker.Evaluate(ctx, t0.Add(2*time.Hour))
+
+	// Sender 20's BTC call in group 1 was not first and does not count
+	entries := tracker.Leaderboard(BySender, time.Hour, 0)
+	if len(entries) != 2 || entries[0].ID != 20 || entries[1].ID != 10 {
+		t.Fatalf("leaderboard = %+v, want sender 20 then 10", entries)
+	}
+	if entries[0].Calls != 1 || entries[0].WinRate != 1 {
+		t.Errorf("sender 20 = %+v, want one winning call", entries[0])
+	}
+
+	groups := tracker.Leaderboard(ByGroup, time.Hour, 1)
+	if len(groups) != 1 || groups[0].ID != 2 {
+		t.Errorf("top group = %+v, want group 2", groups)
+	}
+}
+
+// liveSource quotes one price at the time it is set to, whatever is asked
+type liveSource struct {
+	price float64
+	now   time.Time
+}
+
+func (s *liveSource) Quote(_ context.Context, symbol string, _ time.Time) (market.Quote, error) {
+	return market.Quote{Symbol: symbol, Price: s.price, Time: s.now}, nil
+}
+
+func TestEvaluateLiveSource(t *testing.T) {
+	ctx := context.Background()
+	live := &liveSource{price: 100}
+	tracker := newTestTracker(t, live)
+	tracker.Record(ctx, []model.MessageData{
+		message(1, 10, "$BTC", t0),
+		message(1, 20, "$ETH", t0),
+	})
+	btc, eth := tracker.calls[0], tracker.calls[1]
+	if btc.EntryPrice != 0 {
+		t.Fatal("live source priced a call while recording")
+	}
+
+	// Priced two minutes late, horizons count from the quote
+	live.now = t0.Add(2 * time.Minute)
+	tracker.Evaluate(ctx, live.now)
+	if btc.EntryPrice != 100 || !btc.PriceTime.Equal(live.now) {
+		t.Fatalf("BTC entry = %v at %v, want 100 at %v", btc.EntryPrice, btc.PriceTime, live.now)
+	}
+
+	// The 60m horizon is evaluated in time, the 240m one far too late
+	live.price, live.now = 120, t0.Add(62*time.Minute)
+	tracker.Evaluate(ctx, live.now)
+	if got := btc.Returns[60]; math.Abs(got-20) > 1e-9 {
+		t.Errorf("BTC 60m return = %v, want 20", got)
+	}
+	live.now = t0.Add(10 * time.Hour)
+	tracker.Evaluate(ctx, live.now)
+	if _, ok := btc.Returns[240]; ok || len(btc.Missed) != 1 || btc.Missed[0] != 240 {
+		t.Errorf("BTC returns %v missed %v, want the 240m horizon missed", btc.Returns, btc.Missed)
+	}
+	if eth.Missed[0] != 240 {
+		t.Errorf("ETH missed %v, want 240", eth.Missed)
+	}
+
+	// A call first evaluated long after it was made is not priced at all
+	tracker.Record(ctx, []model.MessageData{message(1, 30, "$SOL", t0.Add(time.Hour))})
+	tracker.Evaluate(ctx, live.now)
+	if sol := tracker.calls[2]; sol.EntryPrice != 0 || !sol.NoPrice {
+		t.Errorf("stale SOL call = %+v, want it left unpriced", sol)
+	}
+}
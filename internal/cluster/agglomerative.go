@@ -0,0 +1,113 @@
+package cluster
+
+import "math"
+
+// Agglomerate groups vectors by average-linkage agglomerative clustering on
+// cosine similarity, merging until no two clusters are more similar than
+// threshold. It returns the member indices of each cluster.
+func Agglomerate(vectors [][]float32, threshold float64) [][]int {
+	n := len(vectors)
+	members := make([][]int, n)
+	for i := range members {
+		members[i] = []int{i}
+	}
+
+	normalized := make([][]float32, n)
+	for i, v := range vectors {
+		normalized[i] = normalize(v)
+	}
+	sim := make([][]float64, n)
+	for i := range sim {
+		sim[i] = make([]float64, n)
+		for j := 0; j < i; j++ {
+			sim[i][j] = dot(normalized[i], normalized[j])
+			sim[j][i] = sim[i][j]
+		}
+	}
+
+	active := make([]bool, n)
+	for i := range active {
+		active[i] = true
+	}
+	for {
+		best, bi, bj := threshold, -1, -1
+		for i := 0; i < n; i++ {
+			if !active[i] {
+				continue
+			}
+			for j := i + 1; j < n; j++ {
+				if active[j] && sim[i][j] >= best {
+					best, bi, bj = sim[i][j], i, j
+				}
+			}
+		}
+		if bi < 0 {
+			break
+		}
+
+		// Lance-Williams update for average linkage, j is merged into i
+		ni, nj := float64(len(members[bi])), float64(len(members[bj]))
+		for k := 0; k < n; k++ {
+			if active[k] && k != bi && k != bj {
+				sim[bi][k] = (ni*sim[bi][k] + nj*sim[bj][k]) / (ni + nj)
+				sim[k][bi] = sim[bi][k]
+			}
+		}
+		members[bi] = append(members[bi], members[bj]...)
+		members[bj] = nil
+		active[bj] = false
+	}
+
+	var clusters [][]int
+	for i, m := range members {
+		if active[i] {
+			clusters = append(clusters, m)
+		}
+	}
+	return clusters
+}
+
+// Centroid returns the normalized mean of the given vectors
+func Centroid(vectors [][]float32, indices []int) []float32 {
+	if len(indices) == 0 {
+		return nil
+	}
+	sum := make([]float32, len(vectors[indices[0]]))
+	for _, i := range indices {
+		for d, x := range normalize(vectors[i]) {
+			if d < len(sum) {
+				sum[d] += x
+			}
+		}
+	}
+	return normalize(sum)
+}
+
+// Similarity returns the cosine similarity of two vectors
+func Similarity(a, b []float32) float64 {
+	return dot(normalize(a), normalize(b))
+}
+
+func normalize(v []float32) []float32 {
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	out := make([]float32, len(v))
+	if norm == 0 {
+		return out
+	}
+	scale := 1 / math.Sqrt(norm)
+	for i, x := range v {
+		out[i] = float32(float64(x) * scale)
+	}
+	return out
+}
+
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range min(len(a), len(b)) {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
@@ -0,0 +1,306 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/FuradWho/TgRadar-Go/internal/entity"
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+)
+
+// samplesPerTopic is how many messages closest to the centroid represent a topic
+const samplesPerTopic = 3
+
+// centroidDecay is the weight of the previous centroid when a story continues,
+// so a story can drift as the discussion moves on
+const centroidDecay = 0.7
+
+// Story is a topic followed across windows
+type Story struct {
+	ID        int       `json:"id"`
+	Title     string    `json:"title"`
+	Centroid  []float32 `json:"centroid"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Windows   int       `json:"windows"`
+	Messages  int       `json:"messages"`
+	// Distinct senders and groups over the whole story
+	Senders []int64 `json:"senders"`
+	Groups  []int64 `json:"groups"`
+}
+
+// Topic is a cluster of one window, linked to the story it continues
+type Topic struct {
+	StoryID int
+	Title   string
+	// First window of the story
+	New bool
+	// Windows the story has been seen in, including this one
+	Windows      int
+	Messages     int
+	Participants int
+	// Reactions, replies and forwards of the topic's messages
+	Engagement int
+	// Participants scaled by the mean engagement weight of the messages,
+	// what topics are ranked by
+	Heat    float64
+	Groups  []int64
+	Symbols []string
+	Samples []model.MessageData
+}
+
+// Tracker clusters each window's messages and follows clusters as stories
+type Tracker struct {
+	path           string
+	threshold      float64
+	minMessages    int
+	storyThreshold float64
+	ttl            time.Duration
+	stories        []*Story
+	nextID         int
+	mu             sync.Mutex
+}
+
+// NewTracker loads stories from the configured file, a missing file starts empty
+func NewTracker(cfg *config.Config) (*Tracker, error) {
+	cc := cfg.Cluster
+	t := &Tracker{
+		path:           cc.File,
+		threshold:      cc.Threshold,
+		minMessages:    cc.MinMessages,
+		storyThreshold: cc.StoryThreshold,
+		ttl:            time.Duration(cc.StoryTTLHours) * time.Hour,
+		nextID:         1,
+	}
+
+	data, err := os.ReadFile(t.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read stories file: %w", err)
+	}
+	if err := json.Unmarshal(data, &t.stories); err != nil {
+		return nil, fmt.Errorf("parse stories file: %w", err)
+	}
+	for _, s := range t.stories {
+		t.nextID = max(t.nextID, s.ID+1)
+	}
+	return t, nil
+}
+
+// Update clusters a window of messages with their embeddings and links each
+// cluster to a continuing or new story. Topics are ordered by heat, which is
+// the participant count when no message has engagement.
+func (t *Tracker) Update(msgs []model.MessageData, vectors [][]float32, now time.Time) []Topic {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.expire(now)
+
+	var topics []Topic
+	claimed := make(map[int]bool)
+	for _, members := range Agglomerate(vectors, t.threshold) {
+		if len(members) < t.minMessages {
+			continue
+		}
+
+		centroid := Centroid(vectors, members)
+		senders := make(map[int64]bool)
+		groups := make(map[int64]bool)
+		engagement, weight := 0, 0.0
+		for _, i := range members {
+			if msgs[i].SenderID != 0 {
+				senders[msgs[i].SenderID] = true
+			}
+			groups[msgs[i].GroupID] = true
+			engagement += msgs[i].Engagement()
+			weight += msgs[i].Weight()
+		}
+
+		story := t.match(centroid, claimed)
+		topic := Topic{
+			Messages:     len(members),
+			Participants: len(senders),
+			Engagement:   engagement,
+			Heat:         float64(len(senders)) * weight / float64(len(members)),
+			Groups:       sortedKeys(groups),
+			Symbols:      topSymbols(msgs, members),
+			Samples:      samples(msgs, vectors, members, centroid),
+		}
+		if story == nil {
+			story = &Story{ID: t.nextID, FirstSeen: now, Centroid: centroid}
+			t.nextID++
+			t.stories = append(t.stories, story)
+			topic.New = true
+		} else {
+			for d := range story.Centroid {
+				if d < len(centroid) {
+					story.Centroid[d] = centroidDecay*story.Centroid[d] + (1-centroidDecay)*centroid[d]
+				}
+			}
+		}
+		claimed[story.ID] = true
+
+		story.LastSeen = now
+		story.Windows++
+		story.Messages += len(members)
+		story.Senders = mergeIDs(story.Senders, senders)
+		story.Groups = mergeIDs(story.Groups, groups)
+		if story.Title == "" || topic.New {
+			story.Title = title(topic)
+		}
+
+		topic.StoryID = story.ID
+		topic.Title = story.Title
+		topic.Windows = story.Windows
+		topics = append(topics, topic)
+	}
+
+	sort.SliceStable(topics, func(i, j int) bool {
+		if topics[i].Heat != topics[j].Heat {
+			return topics[i].Heat > topics[j].Heat
+		}
+		return topics[i].Messages > topics[j].Messages
+	})
+	return topics
+}
+
+// Stories returns the tracked stories, most recently seen first
+func (t *Tracker) Stories() []Story {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stories := make([]Story, 0, len(t.stories))
+	for _, s := range t.stories {
+		story := *s
+		story.Centroid = nil
+		stories = append(stories, story)
+	}
+	sort.Slice(stories, func(i, j int) bool { return stories[i].LastSeen.After(stories[j].LastSeen) })
+	return stories
+}
+
+// Save writes the stories to the configured file
+func (t *Tracker) Save(now time.Time) error {
+	t.mu.Lock()
+	t.expire(now)
+	data, err := json.Marshal(t.stories)
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write stories file: %w", err)
+	}
+	return os.Rename(tmp, t.path)
+}
+
+// match returns the most similar live story not yet continued this window
+func (t *Tracker) match(centroid []float32, claimed map[int]bool) *Story {
+	var best *Story
+	bestSim := t.storyThreshold
+	for _, s := range t.stories {
+		if claimed[s.ID] {
+			continue
+		}
+		if sim := Similarity(centroid, s.Centroid); sim >= bestSim {
+			best, bestSim = s, sim
+		}
+	}
+	return best
+}
+
+// expire drops stories not seen within the TTL
+func (t *Tracker) expire(now time.Time) {
+	if t.ttl <= 0 {
+		return
+	}
+	kept := t.stories[:0]
+	for _, s := range t.stories {
+		if now.Sub(s.LastSeen) < t.ttl {
+			kept = append(kept, s)
+		}
+	}
+	t.stories = kept
+}
+
+// samples picks the messages closest to the centroid
+func samples(msgs []model.MessageData, vectors [][]float32, members []int, centroid []float32) []model.MessageData {
+	ranked := append([]int(nil), members...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return Similarity(vectors[ranked[i]], centroid) > Similarity(vectors[ranked[j]], centroid)
+	})
+
+	var picked []model.MessageData
+	for _, i := range ranked[:min(samplesPerTopic, len(ranked))] {
+		picked = append(picked, msgs[i])
+	}
+	return picked
+}
+
+// topSymbols lists the tickers and contracts of a cluster by mention count
+func topSymbols(msgs []model.MessageData, members []int) []string {
+	counts := make(map[string]int)
+	for _, i := range members {
+		for _, symbol := range entity.Extract(msgs[i].Text).Symbols() {
+			counts[symbol]++
+		}
+	}
+
+	symbols := make([]string, 0, len(counts))
+	for symbol := range counts {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		if counts[symbols[i]] != counts[symbols[j]] {
+			return counts[symbols[i]] > counts[symbols[j]]
+		}
+		return symbols[i] < symbols[j]
+	})
+	return symbols
+}
+
+// title names a story after its main symbol, or the start of its best sample
+func title(topic Topic) string {
+	if len(topic.Symbols) > 0 {
+		return topic.Symbols[0]
+	}
+	if len(topic.Samples) == 0 {
+		return ""
+	}
+	text := topic.Samples[0].Text
+	if utf8.RuneCountInString(text) > 20 {
+		text = string([]rune(text)[:20]) + "…"
+	}
+	return text
+}
+
+func mergeIDs(ids []int64, add map[int64]bool) []int64 {
+	set := make(map[int64]bool, len(ids)+len(add))
+	for _, id := range ids {
+		set[id] = true
+	}
+	for id := range add {
+		set[id] = true
+	}
+	return sortedKeys(set)
+}
+
+func sortedKeys(set map[int64]bool) []int64 {
+	keys := make([]int64, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
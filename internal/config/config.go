@@ -2,7 +2,13 @@ package config
 
 import (
 	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/FuradWho/TgRadar-Go/internal/model"
 	"github.com/spf13/viper"
 )
 
@@ -11,33 +17,438 @@ type Config struct {
 		AppID       int    `mapstructure:"app_id"`
 		AppHash     string `mapstructure:"app_hash"`
 		SessionFile string `mapstructure:"session_file"`
-		Phone       string `mapstructure:"phone"`
-		Password    string `mapstructure:"password"`
-		Proxy       string `mapstructure:"proxy"`
-		TargetGroups []int64 `mapstructure:"target_groups"`
-		BotToken     string  `mapstructure:"bot_token"`
-		BotChatID    int64   `mapstructure:"bot_chat_id"`
+		// Encrypts the session file, which holds the account's auth key
+		SessionKey struct {
+			// Where the key comes from, empty stores the session in plaintext
+			Source string `mapstructure:"source"`
+			// The key is derived from the passphrase in this env var
+			PassphraseEnv string `mapstructure:"passphrase_env"`
+			// A base64 encoded 32 byte key in this env var or file
+			KeyEnv  string `mapstructure:"key_env"`
+			KeyFile string `mapstructure:"key_file"`
+		} `mapstructure:"session_key"`
+		// Update state (pts/qts/seq per channel) used to recover missed messages
+		StateFile string `mapstructure:"state_file"`
+		Phone     string `mapstructure:"phone"`
+		Password  string `mapstructure:"password"`
+		Proxy     string `mapstructure:"proxy"`
+		// Groups to read, empty reads all, see ParseGroupID for the forms
+		// besides IDs. Exclusions also apply to every listed account.
+		TargetGroups  []string `mapstructure:"target_groups"`
+		ExcludeGroups []string `mapstructure:"exclude_groups"`
+		BotToken      string   `mapstructure:"bot_token"`
+		BotChatID     int64    `mapstructure:"bot_chat_id"`
+		// Accounts read in parallel, the fields above make up the only
+		// account when empty
+		Accounts []Account `mapstructure:"accounts"`
+		// Kinds of chats messages are read from. Direct messages are not
+		// limited by target_groups.
+		Sources struct {
+			Supergroups bool `mapstructure:"supergroups"`
+			Groups      bool `mapstructure:"groups"`
+			Channels    bool `mapstructure:"channels"`
+			DMs         bool `mapstructure:"dms"`
+		} `mapstructure:"sources"`
+		Login struct {
+			Method string `mapstructure:"method"`
+			// Where login codes come from, the password too when none is configured
+			CodeSource string `mapstructure:"code_source"`
+			// The env source polls CodeEnv, then CodeFile, for the code and
+			// reads the password from PasswordEnv
+			CodeEnv     string `mapstructure:"code_env"`
+			PasswordEnv string `mapstructure:"password_env"`
+			CodeFile    string `mapstructure:"code_file"`
+			// Users allowed to answer the bot, required when code_source is bot
+			BotUsers []int64 `mapstructure:"bot_users"`
+			// QR login codes are also saved here as PNG when set
+			QRFile         string `mapstructure:"qr_file"`
+			TimeoutSeconds int    `mapstructure:"timeout_seconds"`
+		} `mapstructure:"login"`
+		Reconnect struct {
+			MinBackoffSeconds int `mapstructure:"min_backoff_seconds"`
+			MaxBackoffSeconds int `mapstructure:"max_backoff_seconds"`
+			// A connection failing health checks this long is restarted
+			DeadAfterSeconds int `mapstructure:"dead_after_seconds"`
+			// Disconnections lasting this long are reported to the bot chat
+			AlertAfterSeconds int `mapstructure:"alert_after_seconds"`
+		} `mapstructure:"reconnect"`
 	} `mapstructure:"telegram"`
 
 	Monitor struct {
-		WindowSeconds int  `mapstructure:"window_seconds"`
-		Debug         bool `mapstructure:"debug"`
+		WindowSeconds  int             `mapstructure:"window_seconds"`
+		MinMessages    int             `mapstructure:"min_messages"`
+		MinSenders     int             `mapstructure:"min_senders"`
+		MaxWaitSeconds int             `mapstructure:"max_wait_seconds"`
+		PromptProfile  string          `mapstructure:"prompt_profile"`
+		Groups         []GroupOverride `mapstructure:"groups"`
+		Debug          bool            `mapstructure:"debug"`
+		// A window held below its thresholds is analyzed anyway once it
+		// buffers this many messages, so a group never grows without bound
+		MaxHeldMessages int `mapstructure:"max_held_messages"`
+		// Prompt profile of broadcast channels without one of their own
+		ChannelPromptProfile string `mapstructure:"channel_prompt_profile"`
+		// Time the final analysis on shutdown may take before the buffer is persisted
+		ShutdownTimeoutSeconds int `mapstructure:"shutdown_timeout_seconds"`
+		// Messages left unanalyzed at shutdown, restored on the next start
+		PendingFile string `mapstructure:"pending_file"`
+		// Messages recovered after a gap a group's window takes, the rest are dropped
+		MaxLateMessages int `mapstructure:"max_late_messages"`
 	} `mapstructure:"monitor"`
 
-	AI struct {
-		APIKey   string `mapstructure:"api_key"`
-		BaseURL  string `mapstructure:"base_url"`
-		Model    string `mapstructure:"model"`
+	Filter struct {
+		MinRunes        int      `mapstructure:"min_runes"`
+		DropBots        bool     `mapstructure:"drop_bots"`
+		BotSenders      []int64  `mapstructure:"bot_senders"`
+		Blocklist       []string `mapstructure:"blocklist"`
+		MaxPerSender    int      `mapstructure:"max_per_sender"`
+		Dedup           bool     `mapstructure:"dedup"`
+		NearDupDistance int      `mapstructure:"near_dup_distance"`
+	} `mapstructure:"filter"`
+
+	Translate struct {
+		Enabled bool `mapstructure:"enabled"`
+		// Analysis language messages in other languages are translated into
 		Language string `mapstructure:"language"`
+		// Messages per translation request
+		BatchSize int `mapstructure:"batch_size"`
+		// Translations kept in memory so repeated texts are not re-sent
+		CacheSize int `mapstructure:"cache_size"`
+		// Upper bound on the completion tokens of a translation request
+		MaxTokens int `mapstructure:"max_tokens"`
+	} `mapstructure:"translate"`
+
+	Reputation struct {
+		Enabled            bool    `mapstructure:"enabled"`
+		File               string  `mapstructure:"file"`
+		TrendMinSenders    int     `mapstructure:"trend_min_senders"`
+		LookbackHours      int     `mapstructure:"lookback_hours"`
+		HighSignalScore    float64 `mapstructure:"high_signal_score"`
+		HighSignalMessages int     `mapstructure:"high_signal_messages"`
+		OrderChatLog       bool    `mapstructure:"order_chat_log"`
+	} `mapstructure:"reputation"`
+
+	Calls struct {
+		Enabled        bool   `mapstructure:"enabled"`
+		File           string `mapstructure:"file"`
+		HorizonMinutes []int  `mapstructure:"horizon_minutes"`
+		CooldownHours  int    `mapstructure:"cooldown_hours"`
+		RetentionDays  int    `mapstructure:"retention_days"`
+	} `mapstructure:"calls"`
+
+	Market struct {
+		Source       string `mapstructure:"source"`
+		FixtureFile  string `mapstructure:"fixture_file"`
+		CacheSeconds int    `mapstructure:"cache_seconds"`
+		TopTickers   int    `mapstructure:"top_tickers"`
+		HTTP         struct {
+			URL            string `mapstructure:"url"`
+			PriceField     string `mapstructure:"price_field"`
+			Change1hField  string `mapstructure:"change_1h_field"`
+			Change24hField string `mapstructure:"change_24h_field"`
+		} `mapstructure:"http"`
+	} `mapstructure:"market"`
+
+	Cluster struct {
+		Enabled bool `mapstructure:"enabled"`
+		// Average-linkage cosine similarity above which messages join a topic
+		Threshold   float64 `mapstructure:"threshold"`
+		MinMessages int     `mapstructure:"min_messages"`
+		// Most recent messages clustered per window, bounds the O(n³) work
+		MaxMessages int `mapstructure:"max_messages"`
+		// Centroid similarity above which a topic continues an earlier story
+		StoryThreshold float64 `mapstructure:"story_threshold"`
+		StoryTTLHours  int     `mapstructure:"story_ttl_hours"`
+		File           string  `mapstructure:"file"`
+	} `mapstructure:"cluster"`
+
+	Engagement struct {
+		// Re-fetch reactions, views and replies of a window's messages
+		// before it is analyzed, costing a request per group and account
+		Refresh               bool `mapstructure:"refresh"`
+		RefreshTimeoutSeconds int  `mapstructure:"refresh_timeout_seconds"`
+		// Windows with fewer messages keep the counters from updates
+		RefreshMinMessages int `mapstructure:"refresh_min_messages"`
+	} `mapstructure:"engagement"`
+
+	Storage struct {
+		Path string `mapstructure:"path"`
+		// Archive raw messages so they can be exported later
+		Messages bool `mapstructure:"messages"`
+	} `mapstructure:"storage"`
+
+	Export struct {
+		// Write messages to files as they arrive
+		Live   bool     `mapstructure:"live"`
+		Dir    string   `mapstructure:"dir"`
+		Format string   `mapstructure:"format"`
+		Fields []string `mapstructure:"fields"`
+		// Replace sender IDs, names and usernames with salted hashes
+		HashPII  bool   `mapstructure:"hash_pii"`
+		HashSalt string `mapstructure:"hash_salt"`
+	} `mapstructure:"export"`
+
+	API struct {
+		Listen string `mapstructure:"listen"`
+		Token  string `mapstructure:"token"`
+	} `mapstructure:"api"`
+
+	Cost struct {
+		Prices          map[string]ModelPrice `mapstructure:"prices"`
+		DailyBudget     float64               `mapstructure:"daily_budget"`
+		MonthlyBudget   float64               `mapstructure:"monthly_budget"`
+		FallbackModel   string                `mapstructure:"fallback_model"`
+		SkipLowPriority bool                  `mapstructure:"skip_low_priority"`
+	} `mapstructure:"cost"`
+
+	AI struct {
+		APIKey         string            `mapstructure:"api_key"`
+		BaseURL        string            `mapstructure:"base_url"`
+		Model          string            `mapstructure:"model"`
+		Language       string            `mapstructure:"language"`
+		PromptProfiles map[string]string `mapstructure:"prompt_profiles"`
+		// Stream the global summary so slow models are not cut off by the timeout
+		Stream bool `mapstructure:"stream"`
+		// Extra OpenAI-compatible backends, api_key/base_url above form the "default" provider
+		Providers map[string]ProviderConfig `mapstructure:"providers"`
+		// Ordered failover chains per stage, empty means the default provider with ai.model
+		GroupModels   []ModelRef `mapstructure:"group_models"`
+		SummaryModels []ModelRef `mapstructure:"summary_models"`
+		// Translation chain, empty means the group chain
+		TranslateModels []ModelRef `mapstructure:"translate_models"`
+		// Embedding model for semantic search, disabled when model is empty
+		Embedding ModelRef `mapstructure:"embedding"`
 	} `mapstructure:"ai"`
 }
 
+// Login methods and code sources
+const (
+	LoginCode = "code"
+	LoginQR   = "qr"
+
+	CodeSourceStdin = "stdin"
+	CodeSourceEnv   = "env"
+	CodeSourceFile  = "file"
+	CodeSourceBot   = "bot"
+)
+
+// Session key sources
+const (
+	KeySourcePassphrase = "passphrase"
+	KeySourceEnv        = "env"
+	KeySourceFile       = "file"
+)
+
+// DefaultProvider names the provider built from ai.api_key and ai.base_url
+const DefaultProvider = "default"
+
+// Export file formats
+const (
+	ExportJSONL   = "jsonl"
+	ExportCSV     = "csv"
+	ExportParquet = "parquet"
+)
+
+// Provider types
+const (
+	ProviderOpenAI = "openai"
+	// ProviderMock echoes prompts without calling an API, for replays
+	ProviderMock = "mock"
+)
+
+// Account is a Telegram user account messages are read from
+type Account struct {
+	Name        string `mapstructure:"name"`
+	SessionFile string `mapstructure:"session_file"`
+	// Defaults to updates_<name>.json
+	StateFile string `mapstructure:"state_file"`
+	Phone     string `mapstructure:"phone"`
+	Password  string `mapstructure:"password"`
+	// Defaults to telegram.proxy
+	Proxy         string   `mapstructure:"proxy"`
+	TargetGroups  []string `mapstructure:"target_groups"`
+	ExcludeGroups []string `mapstructure:"exclude_groups"`
+}
+
+// DefaultAccount names the account built from the top level telegram fields
+const DefaultAccount = "default"
+
+// ProviderConfig is an LLM backend, OpenAI-compatible unless Type says otherwise
+type ProviderConfig struct {
+	Type    string `mapstructure:"type"`
+	APIKey  string `mapstructure:"api_key"`
+	BaseURL string `mapstructure:"base_url"`
+}
+
+// ModelRef selects a model on a provider, an empty provider means the default one
+type ModelRef struct {
+	Provider string `mapstructure:"provider"`
+	Model    string `mapstructure:"model"`
+}
+
+// ModelPrice is the USD price per million tokens of a model
+type ModelPrice struct {
+	Prompt     float64 `mapstructure:"prompt"`
+	Completion float64 `mapstructure:"completion"`
+}
+
+// Group priorities, low priority groups are skipped first when over budget
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+)
+
+// GroupOverride overrides the monitor defaults for a single group. Unset
+// fields inherit the corresponding monitor setting, so 0 can turn a
+// threshold off for one group.
+type GroupOverride struct {
+	ID             int64  `mapstructure:"id"`
+	WindowSeconds  *int   `mapstructure:"window_seconds"`
+	MinMessages    *int   `mapstructure:"min_messages"`
+	MinSenders     *int   `mapstructure:"min_senders"`
+	MaxWaitSeconds *int   `mapstructure:"max_wait_seconds"`
+	PromptProfile  string `mapstructure:"prompt_profile"`
+	Priority       string `mapstructure:"priority"`
+}
+
+// GroupConfig holds the effective settings of a group
+type GroupConfig struct {
+	ID             int64  `mapstructure:"id"`
+	WindowSeconds  int    `mapstructure:"window_seconds"`
+	MinMessages    int    `mapstructure:"min_messages"`
+	MinSenders     int    `mapstructure:"min_senders"`
+	MaxWaitSeconds int    `mapstructure:"max_wait_seconds"`
+	PromptProfile  string `mapstructure:"prompt_profile"`
+	Priority       string `mapstructure:"priority"`
+}
+
+// Window returns the analysis window length
+func (g GroupConfig) Window() time.Duration {
+	return time.Duration(g.WindowSeconds) * time.Second
+}
+
+// MaxWait returns how long a quiet group may be held back, 0 means forever
+func (g GroupConfig) MaxWait() time.Duration {
+	return time.Duration(g.MaxWaitSeconds) * time.Second
+}
+
+// SourceSettings resolves the settings for a group read as source, broadcast
+// channels use the channel prompt profile unless they set their own
+func (c *Config) SourceSettings(groupID int64, source string) GroupConfig {
+	settings := c.GroupSettings(groupID)
+	if source != model.SourceChannel || c.Monitor.ChannelPromptProfile == "" {
+		return settings
+	}
+	for _, g := range c.Monitor.Groups {
+		if g.ID == groupID && g.PromptProfile != "" {
+			return settings
+		}
+	}
+	settings.PromptProfile = c.Monitor.ChannelPromptProfile
+	return settings
+}
+
+// GroupSettings resolves the effective settings for a group
+func (c *Config) GroupSettings(groupID int64) GroupConfig {
+	settings := GroupConfig{
+		ID:             groupID,
+		WindowSeconds:  c.Monitor.WindowSeconds,
+		MinMessages:    c.Monitor.MinMessages,
+		MinSenders:     c.Monitor.MinSenders,
+		MaxWaitSeconds: c.Monitor.MaxWaitSeconds,
+		PromptProfile:  c.Monitor.PromptProfile,
+		Priority:       PriorityNormal,
+	}
+
+	for _, g := range c.Monitor.Groups {
+		if g.ID != groupID {
+			continue
+		}
+		if g.WindowSeconds != nil {
+			settings.WindowSeconds = *g.WindowSeconds
+		}
+		if g.MinMessages != nil {
+			settings.MinMessages = *g.MinMessages
+		}
+		if g.MinSenders != nil {
+			settings.MinSenders = *g.MinSenders
+		}
+		if g.MaxWaitSeconds != nil {
+			settings.MaxWaitSeconds = *g.MaxWaitSeconds
+		}
+		if g.PromptProfile != "" {
+			settings.PromptProfile = g.PromptProfile
+		}
+		if g.Priority != "" {
+			settings.Priority = g.Priority
+		}
+		break
+	}
+
+	return settings
+}
+
 // LoadConfig parses config.yml from current directory
 func LoadConfig() (*Config, error) {
 	viper.SetConfigName("config") // Config filename (without extension)
 	viper.SetConfigType("yml")    // Config file type
 	viper.AddConfigPath(".")      // Search path: current directory
 
+	viper.SetDefault("telegram.state_file", "updates.json")
+	viper.SetDefault("telegram.session_key.passphrase_env", "TGRADAR_SESSION_PASSPHRASE")
+	viper.SetDefault("telegram.session_key.key_env", "TGRADAR_SESSION_KEY")
+	viper.SetDefault("telegram.sources.supergroups", true)
+	viper.SetDefault("telegram.sources.groups", true)
+	viper.SetDefault("telegram.sources.channels", true)
+	viper.SetDefault("telegram.login.method", LoginCode)
+	viper.SetDefault("telegram.login.code_source", CodeSourceStdin)
+	viper.SetDefault("telegram.login.code_env", "TGRADAR_LOGIN_CODE")
+	viper.SetDefault("telegram.login.password_env", "TGRADAR_PASSWORD")
+	viper.SetDefault("telegram.login.code_file", "login_code.txt")
+	viper.SetDefault("telegram.login.timeout_seconds", 600)
+	viper.SetDefault("telegram.reconnect.min_backoff_seconds", 1)
+	viper.SetDefault("telegram.reconnect.max_backoff_seconds", 300)
+	viper.SetDefault("telegram.reconnect.dead_after_seconds", 120)
+	viper.SetDefault("telegram.reconnect.alert_after_seconds", 300)
+	viper.SetDefault("monitor.window_seconds", 60)
+	viper.SetDefault("monitor.prompt_profile", "default")
+	viper.SetDefault("monitor.channel_prompt_profile", "news")
+	viper.SetDefault("monitor.shutdown_timeout_seconds", 60)
+	viper.SetDefault("monitor.pending_file", "pending.jsonl")
+	viper.SetDefault("monitor.max_late_messages", 500)
+	viper.SetDefault("monitor.max_held_messages", 5000)
+	viper.SetDefault("filter.min_runes", 2)
+	viper.SetDefault("filter.drop_bots", true)
+	viper.SetDefault("filter.dedup", true)
+	viper.SetDefault("filter.near_dup_distance", 3)
+	viper.SetDefault("translate.language", "zh")
+	viper.SetDefault("translate.batch_size", 20)
+	viper.SetDefault("translate.cache_size", 5000)
+	viper.SetDefault("translate.max_tokens", 4000)
+	viper.SetDefault("reputation.file", "reputation.json")
+	viper.SetDefault("reputation.trend_min_senders", 3)
+	viper.SetDefault("reputation.lookback_hours", 24)
+	viper.SetDefault("reputation.high_signal_score", 0.5)
+	viper.SetDefault("reputation.high_signal_messages", 20)
+	viper.SetDefault("storage.path", "tgradar.db")
+	viper.SetDefault("ai.stream", true)
+	viper.SetDefault("cluster.threshold", 0.8)
+	viper.SetDefault("cluster.min_messages", 3)
+	viper.SetDefault("cluster.max_messages", 500)
+	viper.SetDefault("cluster.story_threshold", 0.75)
+	viper.SetDefault("cluster.story_ttl_hours", 24)
+	viper.SetDefault("cluster.file", "stories.json")
+	viper.SetDefault("engagement.refresh_timeout_seconds", 10)
+	viper.SetDefault("engagement.refresh_min_messages", 20)
+	viper.SetDefault("export.dir", "export")
+	viper.SetDefault("export.format", ExportJSONL)
+	viper.SetDefault("market.cache_seconds", 60)
+	viper.SetDefault("market.top_tickers", 5)
+	viper.SetDefault("calls.file", "calls.json")
+	viper.SetDefault("calls.horizon_minutes", []int{60, 240, 1440})
+	viper.SetDefault("calls.cooldown_hours", 24)
+	viper.SetDefault("calls.retention_days", 30)
+
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("failed to read config: %w\nensure config.yaml exists in current directory", err)
 	}
@@ -51,6 +462,226 @@ func LoadConfig() (*Config, error) {
 	if cfg.Telegram.AppID == 0 || cfg.Telegram.AppHash == "" {
 		return nil, fmt.Errorf("config error: app_id and app_hash cannot be empty")
 	}
+	if cfg.Monitor.WindowSeconds <= 0 {
+		return nil, fmt.Errorf("config error: window_seconds must be positive")
+	}
+	if cfg.Monitor.MaxLateMessages <= 0 {
+		return nil, fmt.Errorf("config error: monitor.max_late_messages must be positive")
+	}
+	if cfg.Monitor.MaxHeldMessages <= 0 {
+		return nil, fmt.Errorf("config error: monitor.max_held_messages must be positive")
+	}
+	if err := cfg.resolveAccounts(); err != nil {
+		return nil, err
+	}
+	for i, g := range cfg.Monitor.Groups {
+		// Accept the marked IDs clients show, as target_groups does
+		id, ok := ParseGroupID(strconv.FormatInt(g.ID, 10))
+		if !ok {
+			return nil, fmt.Errorf("config error: monitor.groups entry without id")
+		}
+		g.ID = id
+		cfg.Monitor.Groups[i].ID = id
+		if g.WindowSeconds != nil && *g.WindowSeconds <= 0 {
+			return nil, fmt.Errorf("config error: group %d window_seconds must be positive", g.ID)
+		}
+		for _, v := range []*int{g.MinMessages, g.MinSenders, g.MaxWaitSeconds} {
+			if v != nil && *v < 0 {
+				return nil, fmt.Errorf("config error: group %d has negative settings", g.ID)
+			}
+		}
+		switch g.Priority {
+		case "", PriorityLow, PriorityNormal, PriorityHigh:
+		default:
+			return nil, fmt.Errorf("config error: group %d has unknown priority %q", g.ID, g.Priority)
+		}
+	}
+	if (cfg.Cost.DailyBudget > 0 || cfg.Cost.MonthlyBudget > 0) && cfg.Cost.FallbackModel == "" && !cfg.Cost.SkipLowPriority {
+		return nil, fmt.Errorf("config error: cost budgets need fallback_model or skip_low_priority, analysis ignores them otherwise")
+	}
+	if cfg.API.Listen != "" && cfg.API.Token == "" {
+		return nil, fmt.Errorf("config error: api.token is required when api.listen is set")
+	}
+	for _, minutes := range cfg.Calls.HorizonMinutes {
+		if minutes <= 0 {
+			return nil, fmt.Errorf("config error: calls.horizon_minutes must be positive")
+		}
+	}
+	if _, ok := cfg.AI.Providers[DefaultProvider]; ok {
+		return nil, fmt.Errorf("config error: ai.providers cannot redefine the %q provider", DefaultProvider)
+	}
+	for name, pc := range cfg.AI.Providers {
+		switch pc.Type {
+		case "", ProviderOpenAI, ProviderMock:
+		default:
+			return nil, fmt.Errorf("config error: provider %s has unknown type %q", name, pc.Type)
+		}
+	}
+	if ref := cfg.AI.Embedding; ref.Model != "" {
+		if _, ok := cfg.AI.Providers[ref.Provider]; !ok && ref.Provider != "" && ref.Provider != DefaultProvider {
+			return nil, fmt.Errorf("config error: embedding model %s uses unknown provider %q", ref.Model, ref.Provider)
+		}
+	}
+	for _, ref := range slices.Concat(cfg.AI.GroupModels, cfg.AI.SummaryModels, cfg.AI.TranslateModels) {
+		if ref.Model == "" {
+			return nil, fmt.Errorf("config error: ai model chain entry without model")
+		}
+		if _, ok := cfg.AI.Providers[ref.Provider]; !ok && ref.Provider != "" && ref.Provider != DefaultProvider {
+			return nil, fmt.Errorf("config error: model %s uses unknown provider %q", ref.Model, ref.Provider)
+		}
+	}
+	switch key := cfg.Telegram.SessionKey; key.Source {
+	case "", KeySourcePassphrase, KeySourceEnv:
+	case KeySourceFile:
+		if key.KeyFile == "" {
+			return nil, fmt.Errorf("config error: telegram.session_key.source file needs key_file")
+		}
+	default:
+		return nil, fmt.Errorf("config error: unknown telegram.session_key.source %q", key.Source)
+	}
+	login := cfg.Telegram.Login
+	if login.Method != LoginCode && login.Method != LoginQR {
+		return nil, fmt.Errorf("config error: unknown telegram.login.method %q", login.Method)
+	}
+	switch login.CodeSource {
+	case CodeSourceStdin, CodeSourceEnv, CodeSourceFile:
+	case CodeSourceBot:
+		if cfg.Telegram.BotToken == "" || cfg.Telegram.BotChatID == 0 {
+			return nil, fmt.Errorf("config error: telegram.login.code_source bot needs bot_token and bot_chat_id")
+		}
+		if len(login.BotUsers) == 0 {
+			return nil, fmt.Errorf("config error: telegram.login.code_source bot needs bot_users, or anyone in the bot chat could answer")
+		}
+	default:
+		return nil, fmt.Errorf("config error: unknown telegram.login.code_source %q", login.CodeSource)
+	}
+	if rc := cfg.Telegram.Reconnect; rc.MinBackoffSeconds <= 0 || rc.MaxBackoffSeconds < rc.MinBackoffSeconds {
+		return nil, fmt.Errorf("config error: telegram.reconnect needs 0 < min_backoff_seconds <= max_backoff_seconds")
+	}
+	if cfg.Translate.Enabled && (cfg.Translate.Language == "" || cfg.Translate.BatchSize <= 0 || cfg.Translate.MaxTokens <= 0) {
+		return nil, fmt.Errorf("config error: translate needs a language and a positive batch_size and max_tokens")
+	}
+	if cfg.Cluster.Enabled && cfg.AI.Embedding.Model == "" {
+		return nil, fmt.Errorf("config error: cluster.enabled needs ai.embedding.model")
+	}
+	if cfg.Engagement.Refresh && cfg.Engagement.RefreshTimeoutSeconds <= 0 {
+		return nil, fmt.Errorf("config error: engagement.refresh needs a positive refresh_timeout_seconds")
+	}
+	if cfg.Export.HashPII && cfg.Export.HashSalt == "" {
+		return nil, fmt.Errorf("config error: export.hash_pii needs a hash_salt, unsalted hashes of user IDs are easily reversed")
+	}
+	switch cfg.Export.Format {
+	case ExportJSONL, ExportCSV, ExportParquet:
+	default:
+		return nil, fmt.Errorf("config error: unknown export.format %q", cfg.Export.Format)
+	}
+	for _, pattern := range cfg.Filter.Blocklist {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("config error: invalid blocklist pattern %q: %w", pattern, err)
+		}
+	}
 
 	return &cfg, nil
 }
+
+// resolveAccounts fills in account defaults, building the default account
+// from the top level fields when no accounts are listed
+func (c *Config) resolveAccounts() error {
+	tg := &c.Telegram
+	if len(tg.Accounts) == 0 {
+		tg.Accounts = []Account{{
+			Name:          DefaultAccount,
+			SessionFile:   tg.SessionFile,
+			StateFile:     tg.StateFile,
+			Phone:         tg.Phone,
+			Password:      tg.Password,
+			Proxy:         tg.Proxy,
+			TargetGroups:  tg.TargetGroups,
+			ExcludeGroups: tg.ExcludeGroups,
+		}}
+		return validateTargets(tg.Accounts[0])
+	}
+
+	names := make(map[string]bool)
+	files := make(map[string]bool)
+	for i := range tg.Accounts {
+		acc := &tg.Accounts[i]
+		if acc.Name == "" || acc.SessionFile == "" {
+			return fmt.Errorf("config error: telegram.accounts entry %d needs a name and session_file", i)
+		}
+		if names[acc.Name] {
+			return fmt.Errorf("config error: telegram account %s is listed twice", acc.Name)
+		}
+		if acc.StateFile == "" {
+			acc.StateFile = "updates_" + acc.Name + ".json"
+		}
+		if files[acc.SessionFile] || files[acc.StateFile] {
+			return fmt.Errorf("config error: telegram account %s shares a session or state file", acc.Name)
+		}
+		if acc.Proxy == "" {
+			acc.Proxy = tg.Proxy
+		}
+		acc.ExcludeGroups = append(acc.ExcludeGroups, tg.ExcludeGroups...)
+		if err := validateTargets(*acc); err != nil {
+			return err
+		}
+		names[acc.Name] = true
+		files[acc.SessionFile], files[acc.StateFile] = true, true
+	}
+	return nil
+}
+
+// validateTargets checks the title patterns of an account's targets
+func validateTargets(acc Account) error {
+	for _, target := range slices.Concat(acc.TargetGroups, acc.ExcludeGroups) {
+		if pattern, ok := TitlePattern(target); ok {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("config error: account %s has a bad title pattern %s: %w", acc.Name, target, err)
+			}
+		}
+	}
+	return nil
+}
+
+// TargetGroups lists the target groups of every account given by ID, the
+// others are only known once resolved by the Telegram client
+func (c *Config) TargetGroups() []int64 {
+	var ids []int64
+	for _, acc := range c.Telegram.Accounts {
+		for _, target := range acc.TargetGroups {
+			if id, ok := ParseGroupID(target); ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// zeroChannelID offsets channel IDs in the marked form (-100…) most tools show
+const zeroChannelID = -1000000000000
+
+// ParseGroupID parses a target given as an ID, returning the bare channel
+// or chat ID messages carry. Targets may also be @usernames, t.me links and
+// /title patterns/, which are resolved by the Telegram client.
+func ParseGroupID(target string) (int64, bool) {
+	id, err := strconv.ParseInt(strings.TrimSpace(target), 10, 64)
+	switch {
+	case err != nil || id == 0:
+		return 0, false
+	case id < zeroChannelID:
+		return zeroChannelID - id, true
+	case id < 0:
+		return -id, true
+	default:
+		return id, true
+	}
+}
+
+// TitlePattern returns the regexp of a /title pattern/ target
+func TitlePattern(target string) (string, bool) {
+	target = strings.TrimSpace(target)
+	if len(target) < 2 || !strings.HasPrefix(target, "/") || !strings.HasSuffix(target, "/") {
+		return "", false
+	}
+	return target[1 : len(target)-1], true
+}
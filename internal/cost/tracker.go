@@ -0,0 +1,159 @@
+package cost
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/ai"
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/FuradWho/TgRadar-Go/internal/store"
+)
+
+// reportTopN is how many models and groups the cost report lists
+const reportTopN = 5
+
+// Tracker prices LLM usage, persists it and enforces the budget
+type Tracker struct {
+	cfg   *config.Config
+	store *store.Store
+	// Models without a configured price, each logged once
+	unpriced sync.Map
+}
+
+func NewTracker(cfg *config.Config, store *store.Store) *Tracker {
+	return &Tracker{cfg: cfg, store: store}
+}
+
+// Price returns the USD cost of usage on model. Versioned model names such as
+// gpt-4o-2024-08-06 fall back to the longest configured prefix. Models
+// without a price cost nothing and are logged the first time they are seen.
+func (t *Tracker) Price(model string, usage ai.Usage) float64 {
+	model = strings.ToLower(model)
+	price, ok := t.cfg.Cost.Prices[model]
+	if !ok {
+		best := ""
+		for name, p := range t.cfg.Cost.Prices {
+			if strings.HasPrefix(model, name) && len(name) > len(best) {
+				best, price = name, p
+			}
+		}
+		if best == "" {
+			if _, warned := t.unpriced.LoadOrStore(model, true); !warned {
+				log.Printf("Warning: no price for model %s in cost.prices, its usage is counted as free", model)
+			}
+		}
+	}
+	return (float64(usage.PromptTokens)*price.Prompt + float64(usage.CompletionTokens)*price.Completion) / 1e6
+}
+
+// Record persists the usage of one call attributed to a group and window
+func (t *Tracker) Record(ctx context.Context, groupID int64, stage string, result ai.Result, start, end time.Time) error {
+	return t.store.SaveUsage(ctx, &store.Usage{
+		GroupID:          groupID,
+		Stage:            stage,
+		Provider:         result.Provider,
+		Model:            result.Model,
+		PromptTokens:     result.Usage.PromptTokens,
+		CompletionTokens: result.Usage.CompletionTokens,
+		TotalTokens:      result.Usage.TotalTokens,
+		Cost:             t.Price(result.Model, result.Usage),
+		WindowStart:      start,
+		WindowEnd:        end,
+	})
+}
+
+// Totals holds the running totals for the current day and month
+type Totals struct {
+	Day   store.UsageTotals `json:"day"`
+	Month store.UsageTotals `json:"month"`
+}
+
+func (t *Tracker) Totals(ctx context.Context, now time.Time) (Totals, error) {
+	day, err := t.store.UsageSince(ctx, startOfDay(now))
+	if err != nil {
+		return Totals{}, err
+	}
+	month, err := t.store.UsageSince(ctx, startOfMonth(now))
+	if err != nil {
+		return Totals{}, err
+	}
+	return Totals{Day: day, Month: month}, nil
+}
+
+// OverBudget reports whether the daily or monthly budget has been used up
+func (t *Tracker) OverBudget(ctx context.Context, now time.Time) (bool, error) {
+	if t.cfg.Cost.DailyBudget <= 0 && t.cfg.Cost.MonthlyBudget <= 0 {
+		return false, nil
+	}
+
+	totals, err := t.Totals(ctx, now)
+	if err != nil {
+		return false, err
+	}
+	if t.cfg.Cost.DailyBudget > 0 && totals.Day.Cost >= t.cfg.Cost.DailyBudget {
+		return true, nil
+	}
+	return t.cfg.Cost.MonthlyBudget > 0 && totals.Month.Cost >= t.cfg.Cost.MonthlyBudget, nil
+}
+
+// Report renders the /cost report
+func (t *Tracker) Report(ctx context.Context, now time.Time) (string, error) {
+	totals, err := t.Totals(ctx, now)
+	if err != nil {
+		return "", err
+	}
+	byModel, err := t.store.UsageBy(ctx, "model", startOfMonth(now), reportTopN)
+	if err != nil {
+		return "", err
+	}
+	byGroup, err := t.store.UsageBy(ctx, "group", startOfMonth(now), reportTopN)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("💵 LLM Cost\n")
+	b.WriteString(fmt.Sprintf("Today: $%.4f (%d calls, %d tokens)%s\n",
+		totals.Day.Cost, totals.Day.Calls, totals.Day.TotalTokens, budgetNote(totals.Day.Cost, t.cfg.Cost.DailyBudget)))
+	b.WriteString(fmt.Sprintf("Month: $%.4f (%d calls, %d tokens)%s\n",
+		totals.Month.Cost, totals.Month.Calls, totals.Month.TotalTokens, budgetNote(totals.Month.Cost, t.cfg.Cost.MonthlyBudget)))
+
+	if len(byModel) > 0 {
+		b.WriteString("\nBy model (month):\n")
+		for _, u := range byModel {
+			b.WriteString(fmt.Sprintf("• %s $%.4f | in %d / out %d\n", u.Key, u.Cost, u.PromptTokens, u.CompletionTokens))
+		}
+	}
+	if len(byGroup) > 0 {
+		b.WriteString("\nBy group (month):\n")
+		for _, u := range byGroup {
+			name := "Group " + u.Key
+			if u.Key == "0" {
+				name = "Global summary"
+			}
+			b.WriteString(fmt.Sprintf("• %s $%.4f | %d calls\n", name, u.Cost, u.Calls))
+		}
+	}
+	return b.String(), nil
+}
+
+func budgetNote(spent, budget float64) string {
+	if budget <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" / budget $%.2f (%.0f%%)", budget, spent/budget*100)
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+func startOfMonth(t time.Time) time.Time {
+	y, m, _ := t.Date()
+	return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+}
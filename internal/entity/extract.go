@@ -0,0 +1,86 @@
+package entity
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	cashtagRe  = regexp.MustCompile(`\$([A-Za-z][A-Za-z0-9]{1,9})\b`)
+	upperRe    = regexp.MustCompile(`\b[A-Z][A-Z0-9]{1,9}\b`)
+	evmRe      = regexp.MustCompile(`\b0x[a-fA-F0-9]{40}\b`)
+	solanaRe   = regexp.MustCompile(`\b[1-9A-HJ-NP-Za-km-z]{32,44}\b`)
+	hasDigitRe = regexp.MustCompile(`[0-9]`)
+)
+
+// stopwords are uppercase tokens that look like tickers but almost never are
+var stopwords = map[string]struct{}{
+	"AI": {}, "API": {}, "ATH": {}, "ATL": {}, "CEO": {}, "CEX": {}, "DEX": {},
+	"DM": {}, "ETF": {}, "FOMO": {}, "FUD": {}, "GM": {}, "GN": {}, "HODL": {},
+	"IMO": {}, "KOL": {}, "LOL": {}, "NFA": {}, "NFT": {}, "OK": {}, "OTC": {},
+	"PNL": {}, "PR": {}, "RT": {}, "SEC": {}, "TG": {}, "TVL": {}, "UTC": {},
+	"US": {}, "USA": {}, "USD": {}, "WTF": {}, "DYOR": {}, "TLDR": {}, "APY": {},
+}
+
+// Entities holds the tickers and contract addresses mentioned in a message
+type Entities struct {
+	Tickers   []string `json:"tickers,omitempty"`
+	Contracts []string `json:"contracts,omitempty"`
+}
+
+// Empty reports whether nothing was extracted
+func (e Entities) Empty() bool {
+	return len(e.Tickers) == 0 && len(e.Contracts) == 0
+}
+
+// Extract finds tickers ($SOL, SOL) and contract addresses (EVM, Solana) in text.
+// Tickers are uppercased and deduplicated, in order of first appearance.
+func Extract(text string) Entities {
+	var e Entities
+	seen := make(map[string]struct{})
+
+	addTicker := func(t string) {
+		t = strings.ToUpper(t)
+		if _, ok := stopwords[t]; ok {
+			return
+		}
+		if _, ok := seen[t]; ok {
+			return
+		}
+		seen[t] = struct{}{}
+		e.Tickers = append(e.Tickers, t)
+	}
+
+	for _, m := range cashtagRe.FindAllStringSubmatch(text, -1) {
+		addTicker(m[1])
+	}
+	for _, m := range upperRe.FindAllString(text, -1) {
+		addTicker(m)
+	}
+
+	for _, m := range evmRe.FindAllString(text, -1) {
+		if _, ok := seen[m]; !ok {
+			seen[m] = struct{}{}
+			e.Contracts = append(e.Contracts, m)
+		}
+	}
+	for _, m := range solanaRe.FindAllString(text, -1) {
+		// Base58 runs without digits are almost always words or hashes of other things
+		if !hasDigitRe.MatchString(m) || strings.HasPrefix(m, "0x") {
+			continue
+		}
+		if _, ok := seen[m]; !ok {
+			seen[m] = struct{}{}
+			e.Contracts = append(e.Contracts, m)
+		}
+	}
+
+	return e
+}
+
+// Symbols returns every ticker and contract as a single list
+func (e Entities) Symbols() []string {
+	symbols := make([]string, 0, len(e.Tickers)+len(e.Contracts))
+	symbols = append(symbols, e.Tickers...)
+	return append(symbols, e.Contracts...)
+}
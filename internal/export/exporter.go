@@ -0,0 +1,182 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/FuradWho/TgRadar-Go/internal/metrics"
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+)
+
+// queueSize bounds the live export queue, messages beyond it are dropped
+const queueSize = 1000
+
+// fileKey identifies the file of one group and day
+type fileKey struct {
+	groupID int64
+	day     string
+}
+
+// Exporter writes messages to one file per group and day under export.dir,
+// e.g. export/-1001234567890/2026-01-02.jsonl
+type Exporter struct {
+	cfg       *config.Config
+	fields    []string
+	selected  map[string]bool
+	overwrite bool
+	files     map[fileKey]fileWriter
+	queue     chan model.MessageData
+}
+
+func NewExporter(cfg *config.Config) (*Exporter, error) {
+	fields, err := resolveFields(cfg.Export.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]bool, len(fields))
+	for _, name := range fields {
+		selected[name] = true
+	}
+	return &Exporter{
+		cfg:      cfg,
+		fields:   fields,
+		selected: selected,
+		files:    make(map[fileKey]fileWriter),
+		queue:    make(chan model.MessageData, queueSize),
+	}, nil
+}
+
+// Overwrite replaces existing files instead of appending to them, so an
+// export of the same range can be rerun
+func (e *Exporter) Overwrite() {
+	e.overwrite = true
+}
+
+// Add queues a message for the live export
+func (e *Exporter) Add(msg model.MessageData) {
+	select {
+	case e.queue <- msg:
+	default:
+		metrics.MessagesDropped.WithLabelValues(metrics.Group(msg.GroupID), "export_queue_full").Inc()
+	}
+}
+
+// Run writes queued messages until ctx is cancelled, then closes all files
+func (e *Exporter) Run(ctx context.Context) {
+	log.Printf("Exporting messages to %s as %s", e.cfg.Export.Dir, e.cfg.Export.Format)
+	for {
+		select {
+		case msg := <-e.queue:
+			if err := e.Write(msg); err != nil {
+				log.Printf("Export write failed: %v", err)
+			}
+			// Make the files readable whenever the queue runs dry
+			if len(e.queue) == 0 {
+				e.flush()
+			}
+		case <-ctx.Done():
+			// Write what was queued before ingestion stopped
+			for len(e.queue) > 0 {
+				if err := e.Write(<-e.queue); err != nil {
+					log.Printf("Export write failed: %v", err)
+				}
+			}
+			if err := e.Close(); err != nil {
+				log.Printf("Export close failed: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// Write appends a message to the file of its group and day, closing the
+// group's file for an earlier day when the day rolls over
+func (e *Exporter) Write(msg model.MessageData) error {
+	key := fileKey{groupID: msg.GroupID, day: msg.Timestamp.Format("2006-01-02")}
+
+	w, ok := e.files[key]
+	if !ok {
+		for other, ow := range e.files {
+			if other.groupID == key.groupID {
+				if err := ow.Close(); err != nil {
+					log.Printf("Export close failed: %v", err)
+				}
+				delete(e.files, other)
+			}
+		}
+
+		var err error
+		w, err = e.open(key)
+		if err != nil {
+			return err
+		}
+		e.files[key] = w
+	}
+	return w.Write(e.record(msg))
+}
+
+// Close flushes and closes every open file
+func (e *Exporter) Close() error {
+	var errs []error
+	for key, w := range e.files {
+		errs = append(errs, w.Close())
+		delete(e.files, key)
+	}
+	return errors.Join(errs...)
+}
+
+func (e *Exporter) flush() {
+	for _, w := range e.files {
+		if err := w.Flush(); err != nil {
+			log.Printf("Export flush failed: %v", err)
+		}
+	}
+}
+
+func (e *Exporter) open(key fileKey) (fileWriter, error) {
+	dir := filepath.Join(e.cfg.Export.Dir, strconv.FormatInt(key.groupID, 10))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	format := e.cfg.Export.Format
+	path := filepath.Join(dir, key.day+"."+format)
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	switch {
+	case e.overwrite:
+		flags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	case format == config.ExportParquet:
+		// Parquet files cannot be appended to, start a numbered part instead
+		path = nextFreePath(dir, key.day, format)
+		flags = os.O_CREATE | os.O_WRONLY | os.O_EXCL
+	}
+
+	f, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open export file: %w", err)
+	}
+	w, err := newFileWriter(format, f, e.fields, e.cfg.Export.HashPII)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// nextFreePath returns day.ext, or day.N.ext if earlier parts exist
+func nextFreePath(dir, day, ext string) string {
+	path := filepath.Join(dir, day+"."+ext)
+	for n := 1; ; n++ {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return path
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s.%d.%s", day, n, ext))
+	}
+}
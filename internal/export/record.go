@@ -0,0 +1,155 @@
+package export
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/entity"
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+)
+
+// Exportable fields, in default column order
+const (
+	FieldGroupID        = "group_id"
+	FieldGroupTitle     = "group_title"
+	FieldMsgID          = "msg_id"
+	FieldReplyToMsgID   = "reply_to_msg_id"
+	FieldSenderID       = "sender_id"
+	FieldSenderName     = "sender_name"
+	FieldSenderUsername = "sender_username"
+	FieldSenderIsBot    = "sender_is_bot"
+	FieldSenderIsAdmin  = "sender_is_admin"
+	FieldText           = "text"
+	FieldTimestamp      = "timestamp"
+	FieldTickers        = "tickers"
+	FieldContracts      = "contracts"
+	FieldAccount        = "account"
+	FieldSource         = "source"
+	FieldViews          = "views"
+	FieldForwards       = "forwards"
+	FieldReactions      = "reactions"
+	FieldReplies        = "replies"
+)
+
+var allFields = []string{
+	FieldGroupID, FieldGroupTitle, FieldMsgID, FieldReplyToMsgID,
+	FieldSenderID, FieldSenderName, FieldSenderUsername, FieldSenderIsBot, FieldSenderIsAdmin,
+	FieldText, FieldTimestamp, FieldTickers, FieldContracts, FieldAccount,
+	FieldSource, FieldViews, FieldForwards, FieldReactions, FieldReplies,
+}
+
+// piiFields identify a person and are hashed when hash_pii is set
+var piiFields = map[string]bool{
+	FieldSenderID:       true,
+	FieldSenderName:     true,
+	FieldSenderUsername: true,
+}
+
+// hashLen is how many hex characters of the HMAC are kept
+const hashLen = 16
+
+// record turns a message into field values. Sender fields become hashes
+// when hashing is on, sender_id then being a string instead of a number.
+func (e *Exporter) record(msg model.MessageData) map[string]any {
+	entities := entity.Extract(msg.Text)
+	row := map[string]any{
+		FieldGroupID:        msg.GroupID,
+		FieldGroupTitle:     msg.GroupTitle,
+		FieldMsgID:          int64(msg.MsgID),
+		FieldReplyToMsgID:   int64(msg.ReplyToMsgID),
+		FieldSenderID:       msg.SenderID,
+		FieldSenderName:     msg.SenderName,
+		FieldSenderUsername: msg.SenderUsername,
+		FieldSenderIsBot:    msg.SenderIsBot,
+		FieldSenderIsAdmin:  msg.SenderIsAdmin,
+		FieldText:           msg.Text,
+		FieldTimestamp:      msg.Timestamp,
+		FieldTickers:        nonNil(entities.Tickers),
+		FieldContracts:      nonNil(entities.Contracts),
+		FieldAccount:        msg.Account,
+		FieldSource:         msg.Source,
+		FieldViews:          int64(msg.Views),
+		FieldForwards:       int64(msg.Forwards),
+		FieldReactions:      int64(msg.ReactionCount()),
+		FieldReplies:        int64(msg.Replies),
+	}
+
+	if e.cfg.Export.HashPII {
+		senderID := ""
+		if msg.SenderID != 0 {
+			senderID = strconv.FormatInt(msg.SenderID, 10)
+		}
+		row[FieldSenderID] = e.hash(senderID)
+		row[FieldSenderName] = e.hash(msg.SenderName)
+		row[FieldSenderUsername] = e.hash(msg.SenderUsername)
+	}
+
+	for name := range row {
+		if !e.selected[name] {
+			delete(row, name)
+		}
+	}
+	return row
+}
+
+// hash pseudonymizes a value with HMAC-SHA256 keyed by the configured salt,
+// empty values stay empty
+func (e *Exporter) hash(value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(e.cfg.Export.HashSalt))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:hashLen]
+}
+
+// resolveFields validates the configured field selection, empty selects all
+func resolveFields(fields []string) ([]string, error) {
+	if len(fields) == 0 {
+		return allFields, nil
+	}
+
+	known := make(map[string]bool, len(allFields))
+	for _, name := range allFields {
+		known[name] = true
+	}
+	resolved := make([]string, 0, len(fields))
+	for _, name := range fields {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !known[name] {
+			return nil, fmt.Errorf("unknown export field %q", name)
+		}
+		resolved = append(resolved, name)
+	}
+	return resolved, nil
+}
+
+// formatValue renders a value for text formats, lists are comma separated
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case []string:
+		return strings.Join(v, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
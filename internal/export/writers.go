@@ -0,0 +1,167 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/parquet-go/parquet-go"
+)
+
+// fileWriter writes records of one group and day to a file
+type fileWriter interface {
+	Write(row map[string]any) error
+	Flush() error
+	Close() error
+}
+
+func newFileWriter(format string, f *os.File, fields []string, hashPII bool) (fileWriter, error) {
+	switch format {
+	case config.ExportCSV:
+		return newCSVWriter(f, fields)
+	case config.ExportParquet:
+		return newParquetWriter(f, fields, hashPII), nil
+	default:
+		return newJSONLWriter(f), nil
+	}
+}
+
+type jsonlWriter struct {
+	f   *os.File
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newJSONLWriter(f *os.File) *jsonlWriter {
+	buf := bufio.NewWriter(f)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	return &jsonlWriter{f: f, buf: buf, enc: enc}
+}
+
+func (w *jsonlWriter) Write(row map[string]any) error {
+	return w.enc.Encode(row)
+}
+
+func (w *jsonlWriter) Flush() error {
+	return w.buf.Flush()
+}
+
+func (w *jsonlWriter) Close() error {
+	if err := w.buf.Flush(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+type csvWriter struct {
+	f      *os.File
+	w      *csv.Writer
+	fields []string
+}
+
+// newCSVWriter writes the header unless it appends to an existing file
+func newCSVWriter(f *os.File, fields []string) (*csvWriter, error) {
+	w := &csvWriter{f: f, w: csv.NewWriter(f), fields: fields}
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		if err := w.w.Write(fields); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+func (w *csvWriter) Write(row map[string]any) error {
+	record := make([]string, len(w.fields))
+	for i, name := range w.fields {
+		record[i] = formatValue(row[name])
+	}
+	return w.w.Write(record)
+}
+
+func (w *csvWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (w *csvWriter) Close() error {
+	if err := w.Flush(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// parquetWriter writes a flat schema, entity lists are comma separated like in CSV
+type parquetWriter struct {
+	f      *os.File
+	w      *parquet.Writer
+	schema *parquet.Schema
+}
+
+func newParquetWriter(f *os.File, fields []string, hashPII bool) *parquetWriter {
+	group := parquet.Group{}
+	for _, name := range fields {
+		group[name] = parquetNode(name, hashPII)
+	}
+	schema := parquet.NewSchema("message", group)
+	return &parquetWriter{f: f, w: parquet.NewWriter(f, schema), schema: schema}
+}
+
+func parquetNode(name string, hashPII bool) parquet.Node {
+	if hashPII && piiFields[name] {
+		return parquet.String()
+	}
+	switch name {
+	case FieldGroupID, FieldMsgID, FieldReplyToMsgID, FieldSenderID, FieldViews, FieldForwards,
+		FieldReactions, FieldReplies:
+		return parquet.Int(64)
+	case FieldSenderIsBot, FieldSenderIsAdmin:
+		return parquet.Leaf(parquet.BooleanType)
+	case FieldTimestamp:
+		return parquet.Timestamp(parquet.Millisecond)
+	default:
+		return parquet.String()
+	}
+}
+
+func (w *parquetWriter) Write(row map[string]any) error {
+	// Group columns are ordered by name, not by field selection
+	values := make(parquet.Row, 0, len(row))
+	for i, path := range w.schema.Columns() {
+		var v any
+		switch value := row[path[0]].(type) {
+		case time.Time:
+			v = value.UnixMilli()
+		case []string:
+			v = formatValue(value)
+		default:
+			v = value
+		}
+		values = append(values, parquet.ValueOf(v).Level(0, 0, i))
+	}
+	_, err := w.w.WriteRows([]parquet.Row{values})
+	return err
+}
+
+// Flush is a no-op, a parquet file is only readable once closed
+func (w *parquetWriter) Flush() error {
+	return nil
+}
+
+func (w *parquetWriter) Close() error {
+	if err := w.w.Close(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
@@ -0,0 +1,70 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+type cacheKey struct {
+	symbol string
+	bucket int64
+}
+
+type cacheEntry struct {
+	quote   Quote
+	err     error
+	expires time.Time
+}
+
+// CachedSource memoizes quotes per symbol and time bucket. Unknown symbols are
+// cached too, so chat noise that looks like a ticker is not looked up every window.
+type CachedSource struct {
+	source  PriceSource
+	ttl     time.Duration
+	entries map[cacheKey]cacheEntry
+	mu      sync.Mutex
+}
+
+func NewCachedSource(source PriceSource, ttl time.Duration) *CachedSource {
+	return &CachedSource{
+		source:  source,
+		ttl:     ttl,
+		entries: make(map[cacheKey]cacheEntry),
+	}
+}
+
+// Historical reports whether the wrapped source quotes past times
+func (c *CachedSource) Historical() bool {
+	return Historical(c.source)
+}
+
+func (c *CachedSource) Quote(ctx context.Context, symbol string, at time.Time) (Quote, error) {
+	key := cacheKey{symbol: symbol, bucket: at.UnixNano() / int64(c.ttl)}
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.quote, entry.err
+	}
+
+	quote, err := c.source.Quote(ctx, symbol, at)
+	if err != nil && !errors.Is(err, ErrNoPrice) {
+		// Transient failures are retried on the next lookup
+		return quote, err
+	}
+
+	c.mu.Lock()
+	c.entries[key] = cacheEntry{quote: quote, err: err, expires: now.Add(c.ttl)}
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.mu.Unlock()
+
+	return quote, err
+}
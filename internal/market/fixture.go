@@ -0,0 +1,113 @@
+package market
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type pricePoint struct {
+	time  time.Time
+	price float64
+}
+
+// FixtureSource serves prices from a CSV file of symbol,time,price rows.
+// Time is RFC 3339 or unix seconds. It is meant for offline runs and tests.
+type FixtureSource struct {
+	series map[string][]pricePoint
+}
+
+// Historical reports that fixture prices are kept for every time
+func (s *FixtureSource) Historical() bool {
+	return true
+}
+
+func NewFixtureSource(path string) (*FixtureSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open price fixture: %w", err)
+	}
+	defer f.Close()
+
+	return ParseFixture(f)
+}
+
+// ParseFixture reads fixture rows from r, a header row is skipped if present
+func ParseFixture(r io.Reader) (*FixtureSource, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	s := &FixtureSource{series: make(map[string][]pricePoint)}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read price fixture: %w", err)
+		}
+		if line == 1 && strings.EqualFold(record[0], "symbol") {
+			continue
+		}
+
+		ts, err := parseTime(record[1])
+		if err != nil {
+			return nil, fmt.Errorf("price fixture line %d: %w", line, err)
+		}
+		price, err := strconv.ParseFloat(record[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("price fixture line %d: %w", line, err)
+		}
+
+		symbol := strings.ToUpper(record[0])
+		s.series[symbol] = append(s.series[symbol], pricePoint{time: ts, price: price})
+	}
+
+	for _, points := range s.series {
+		sort.Slice(points, func(i, j int) bool { return points[i].time.Before(points[j].time) })
+	}
+	return s, nil
+}
+
+// Quote returns the last price at or before at, with changes against 1h and 24h earlier
+func (s *FixtureSource) Quote(_ context.Context, symbol string, at time.Time) (Quote, error) {
+	symbol = strings.ToUpper(symbol)
+	points := s.series[symbol]
+
+	current, ok := priceAt(points, at)
+	if !ok {
+		return Quote{}, fmt.Errorf("%s at %s: %w", symbol, at.Format(time.RFC3339), ErrNoPrice)
+	}
+
+	q := Quote{Symbol: symbol, Price: current.price, Time: current.time}
+	if past, ok := priceAt(points, at.Add(-time.Hour)); ok && past.price != 0 {
+		q.Change1h = (current.price/past.price - 1) * 100
+	}
+	if past, ok := priceAt(points, at.Add(-24*time.Hour)); ok && past.price != 0 {
+		q.Change24h = (current.price/past.price - 1) * 100
+	}
+	return q, nil
+}
+
+func priceAt(points []pricePoint, at time.Time) (pricePoint, bool) {
+	// First point strictly after at, the one before it is the answer
+	i := sort.Search(len(points), func(i int) bool { return points[i].time.After(at) })
+	if i == 0 {
+		return pricePoint{}, false
+	}
+	return points[i-1], true
+}
+
+func parseTime(value string) (time.Time, error) {
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,114 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+)
+
+// HTTPSource reads live quotes from a generic JSON ticker API.
+// The URL contains a {symbol} placeholder and fields are dot paths into the response,
+// e.g. "data.0.price". Numeric strings are accepted as numbers.
+type HTTPSource struct {
+	urlTemplate string
+	priceField  string
+	change1h    string
+	change24h   string
+	client      *http.Client
+}
+
+func NewHTTPSource(cfg *config.Config) (*HTTPSource, error) {
+	hc := cfg.Market.HTTP
+	if !strings.Contains(hc.URL, "{symbol}") {
+		return nil, fmt.Errorf("market.http.url must contain {symbol}")
+	}
+	if hc.PriceField == "" {
+		return nil, fmt.Errorf("market.http.price_field cannot be empty")
+	}
+
+	return &HTTPSource{
+		urlTemplate: hc.URL,
+		priceField:  hc.PriceField,
+		change1h:    hc.Change1hField,
+		change24h:   hc.Change24hField,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Quote returns the latest quote, at is ignored
+func (s *HTTPSource) Quote(ctx context.Context, symbol string, _ time.Time) (Quote, error) {
+	symbol = strings.ToUpper(symbol)
+	endpoint := strings.ReplaceAll(s.urlTemplate, "{symbol}", url.PathEscape(symbol))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return Quote{}, err
+	}
+	defer resp.Body.Close()
+
+	// Ticker APIs answer unknown symbols with a client error
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		return Quote{}, fmt.Errorf("%s: %s: %w", symbol, resp.Status, ErrNoPrice)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return Quote{}, fmt.Errorf("ticker API failed: %s", resp.Status)
+	}
+
+	var body any
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Quote{}, fmt.Errorf("decode ticker response: %w", err)
+	}
+
+	price, ok := lookupNumber(body, s.priceField)
+	if !ok || price == 0 {
+		return Quote{}, fmt.Errorf("%s: %w", symbol, ErrNoPrice)
+	}
+
+	q := Quote{Symbol: symbol, Price: price, Time: time.Now()}
+	if s.change1h != "" {
+		q.Change1h, _ = lookupNumber(body, s.change1h)
+	}
+	if s.change24h != "" {
+		q.Change24h, _ = lookupNumber(body, s.change24h)
+	}
+	return q, nil
+}
+
+// lookupNumber walks a dot path through decoded JSON, numeric segments index arrays
+func lookupNumber(v any, path string) (float64, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			v = node[key]
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return 0, false
+			}
+			v = node[i]
+		default:
+			return 0, false
+		}
+	}
+
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
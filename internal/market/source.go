@@ -0,0 +1,61 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+)
+
+// ErrNoPrice is returned when a source has no price for a symbol
+var ErrNoPrice = errors.New("no price available")
+
+// Quote is a price observation for a symbol
+type Quote struct {
+	Symbol string
+	Price  float64
+	// Percentage changes, zero when the source cannot tell
+	Change1h  float64
+	Change24h float64
+	Time      time.Time
+}
+
+// PriceSource looks up the price of a symbol at a point in time.
+// Live sources only know the present and ignore at.
+type PriceSource interface {
+	Quote(ctx context.Context, symbol string, at time.Time) (Quote, error)
+}
+
+// Historical reports whether source quotes past times. Sources that only
+// know the present return the live price whatever time is asked for.
+func Historical(source PriceSource) bool {
+	h, ok := source.(interface{ Historical() bool })
+	return ok && h.Historical()
+}
+
+// NewSource builds the configured price source, nil if none is configured
+func NewSource(cfg *config.Config) (PriceSource, error) {
+	var source PriceSource
+	var err error
+
+	switch cfg.Market.Source {
+	case "":
+		return nil, nil
+	case "fixture":
+		source, err = NewFixtureSource(cfg.Market.FixtureFile)
+	case "http":
+		source, err = NewHTTPSource(cfg)
+	default:
+		return nil, fmt.Errorf("unknown market source: %s", cfg.Market.Source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Market.CacheSeconds > 0 {
+		source = NewCachedSource(source, time.Duration(cfg.Market.CacheSeconds)*time.Second)
+	}
+	return source, nil
+}
@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "tgradar"
+
+// Ingestion
+var (
+	MessagesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_received_total",
+		Help:      "Messages received from Telegram per group.",
+	}, []string{"group"})
+
+	MessagesFiltered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_filtered_total",
+		Help:      "Messages removed by the preprocessing pipeline per group and filter.",
+	}, []string{"group", "filter"})
+
+	MessagesByLanguage = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_by_language_total",
+		Help:      "Analyzed messages per group and detected language.",
+	}, []string{"group", "language"})
+
+	MessagesLate = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_late_total",
+		Help:      "Messages recovered after a gap or reconnect per group.",
+	}, []string{"group"})
+
+	MessagesDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_dropped_total",
+		Help:      "Messages dropped before buffering per group and reason.",
+	}, []string{"group", "reason"})
+
+	LastMessageTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_message_timestamp_seconds",
+		Help:      "Unix time of the last message received from Telegram.",
+	})
+
+	TelegramConnected = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "telegram_connected",
+		Help:      "Whether the Telegram connection is up (1) or not (0) per account.",
+	}, []string{"account"})
+
+	TelegramRestarts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_restarts_total",
+		Help:      "Times the Telegram client was restarted after a failure per account.",
+	}, []string{"account"})
+
+	MessagesDuplicate = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_duplicate_total",
+		Help:      "Messages dropped because another account delivered them first, per account.",
+	}, []string{"account"})
+
+	QueueLength = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_length",
+		Help:      "Messages waiting in the analyzer queue.",
+	})
+
+	QueueCapacity = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_capacity",
+		Help:      "Capacity of the analyzer queue.",
+	})
+
+	WindowBuffer = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "window_buffer_messages",
+		Help:      "Messages buffered in the current window per group.",
+	}, []string{"group"})
+)
+
+// Analysis
+var (
+	LLMRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "llm_request_duration_seconds",
+		Help:      "LLM request latency per provider, model and stage.",
+		Buckets:   []float64{1, 2.5, 5, 10, 20, 30, 45, 60, 90},
+	}, []string{"provider", "model", "stage"})
+
+	LLMTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_tokens_total",
+		Help:      "LLM tokens per provider, model and direction (prompt or completion).",
+	}, []string{"provider", "model", "direction"})
+
+	LLMErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_errors_total",
+		Help:      "Failed LLM requests per provider and model.",
+	}, []string{"provider", "model"})
+
+	GlobalSummaryDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "global_summary_duration_seconds",
+		Help:      "Time to produce and deliver a global summary.",
+		Buckets:   []float64{1, 5, 10, 20, 30, 45, 60, 120},
+	})
+)
+
+// Delivery
+var NotifierSends = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "notifier_sends_total",
+	Help:      "Notifier deliveries per sink and result (success or failure).",
+}, []string{"sink", "result"})
+
+// Group formats a group ID as a label value
+func Group(groupID int64) string {
+	return strconv.FormatInt(groupID, 10)
+}
+
+// Result formats an error as a success or failure label value
+func Result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// Handler serves the default registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
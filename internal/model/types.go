@@ -1,13 +1,88 @@
 package model
 
-import "time"
+import (
+	"math"
+	"time"
+)
+
+// Kinds of chats messages come from
+const (
+	SourceSupergroup = "supergroup"
+	SourceGroup      = "group"
+	SourceChannel    = "channel"
+	SourceDM         = "dm"
+)
+
+// DMChatID is the GroupID of a private chat with a user. User IDs and basic
+// group IDs are separate namespaces that can collide, so private chats are
+// keyed by the negated user ID where groups and channels are positive.
+func DMChatID(userID int64) int64 {
+	return -userID
+}
 
 // MessageData holds raw message info
 type MessageData struct {
+	GroupID        int64  `json:"group_id"`
+	GroupTitle     string `json:"group_title,omitempty"`
+	MsgID          int    `json:"msg_id,omitempty"`
+	ReplyToMsgID   int    `json:"reply_to_msg_id,omitempty"`
+	SenderID       int64  `json:"sender_id,omitempty"`
+	SenderName     string `json:"sender_name,omitempty"`
+	SenderUsername string `json:"sender_username,omitempty"`
+	SenderIsBot    bool   `json:"sender_is_bot,omitempty"`
+	SenderIsAdmin  bool   `json:"sender_is_admin,omitempty"`
+	// The sender is a channel, such as an anonymous admin or a channel post
+	SenderIsChannel bool      `json:"sender_is_channel,omitempty"`
+	Text            string    `json:"text"`
+	Timestamp       time.Time `json:"timestamp"`
+	// Language detected during preprocessing and the text translated into
+	// the analysis language, empty when it is already in that language
+	Lang        string `json:"lang,omitempty"`
+	Translation string `json:"translation,omitempty"`
+	// Fetched by the gap recovery after a gap or reconnect rather than pushed
+	Late bool `json:"late,omitempty"`
+	// Telegram account the message arrived on, the first one when several saw it
+	Account string `json:"account,omitempty"`
+	// Kind of chat, channel posts are attributed to the channel as sender
+	Source   string `json:"source,omitempty"`
+	Views    int    `json:"views,omitempty"`
+	Forwards int    `json:"forwards,omitempty"`
+	// Reaction counts by emoji and reply count, updated until analysis
+	Reactions map[string]int `json:"reactions,omitempty"`
+	Replies   int            `json:"replies,omitempty"`
+}
+
+// ReactionCount totals the reactions of every kind
+func (m MessageData) ReactionCount() int {
+	total := 0
+	for _, n := range m.Reactions {
+		total += n
+	}
+	return total
+}
+
+// Engagement totals reactions, replies and forwards. Views are left out as
+// only channel posts have them.
+func (m MessageData) Engagement() int {
+	return m.ReactionCount() + m.Replies + m.Forwards
+}
+
+// Weight scales a message's importance by its engagement, logarithmically
+// so a single viral message does not drown out the rest
+func (m MessageData) Weight() float64 {
+	return 1 + math.Log1p(float64(m.Engagement()))
+}
+
+// Engagement is the latest reactions, views and replies of a message seen
+// after it arrived. Nil reactions and zero counts are unknown.
+type Engagement struct {
+	Account   string
 	GroupID   int64
-	SenderID  int64
-	Text      string
-	Timestamp time.Time
+	MsgID     int
+	Reactions map[string]int
+	Views     int
+	Forwards  int
+	Replies   int
 }
 
 type GroupStats struct {
@@ -0,0 +1,212 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// pollTimeout is the long polling timeout passed to getUpdates
+const pollTimeout = 30
+
+// commandTimeout bounds a command handler. Handlers run in the background
+// so a slow one such as /ask does not hold up other commands or login replies.
+const commandTimeout = 3 * time.Minute
+
+// CommandHandler answers a bot command, args is the text after the command
+type CommandHandler func(ctx context.Context, args string) (string, error)
+
+type telegramGetUpdatesRequest struct {
+	Offset         int64    `json:"offset,omitempty"`
+	Timeout        int      `json:"timeout"`
+	AllowedUpdates []string `json:"allowed_updates"`
+}
+
+type telegramUpdate struct {
+	UpdateID int64             `json:"update_id"`
+	Message  *telegramIncoming `json:"message"`
+}
+
+type telegramIncoming struct {
+	MessageID int64  `json:"message_id"`
+	Text      string `json:"text"`
+	Chat      struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	From struct {
+		ID int64 `json:"id"`
+	} `json:"from"`
+}
+
+type telegramDeleteMessageRequest struct {
+	ChatID    int64 `json:"chat_id"`
+	MessageID int64 `json:"message_id"`
+}
+
+type telegramGetUpdatesResponse struct {
+	OK          bool             `json:"ok"`
+	Description string           `json:"description"`
+	Result      []telegramUpdate `json:"result"`
+}
+
+// Listen long-polls the bot for /commands sent in the configured chat and
+// replies with the handler's output. It blocks until ctx is cancelled.
+func (t *TelegramBot) Listen(ctx context.Context, handlers map[string]CommandHandler) error {
+	pollClient := &http.Client{Timeout: (pollTimeout + 10) * time.Second}
+	var offset int64
+
+	for {
+		updates, err := t.getUpdates(ctx, pollClient, offset)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			log.Printf("Bot getUpdates failed: %v", err)
+			select {
+			case <-time.After(5 * time.Second):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			if update.Message == nil || update.Message.Chat.ID != t.chatID {
+				continue
+			}
+			if t.answer(ctx, update.Message) {
+				continue
+			}
+			go t.dispatch(ctx, handlers, update.Message.Text)
+		}
+	}
+}
+
+func (t *TelegramBot) dispatch(ctx context.Context, handlers map[string]CommandHandler, text string) {
+	name, args, ok := parseCommand(text)
+	if !ok {
+		return
+	}
+	handler, ok := handlers[name]
+	if !ok {
+		return
+	}
+
+	handlerCtx, cancel := context.WithTimeout(ctx, commandTimeout)
+	reply, err := handler(handlerCtx, args)
+	cancel()
+	if err != nil {
+		reply = fmt.Sprintf("/%s failed: %v", name, err)
+	}
+	if err := t.Send(ctx, reply); err != nil {
+		log.Printf("Bot reply to /%s failed: %v", name, err)
+	}
+}
+
+// Ask sends question to the bot chat and waits for the next plain message
+// from one of users, or anyone in the chat when users is empty. The reply
+// is deleted from the chat as it may hold a secret. Listen must be running.
+func (t *TelegramBot) Ask(ctx context.Context, question string, users []int64) (string, error) {
+	reply := make(chan string, 1)
+	t.mu.Lock()
+	if t.reply != nil {
+		t.mu.Unlock()
+		return "", errors.New("another question is waiting for a reply")
+	}
+	t.reply, t.replyAllowed = reply, users
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		t.reply, t.replyAllowed = nil, nil
+		t.mu.Unlock()
+	}()
+
+	if err := t.Send(ctx, question); err != nil {
+		return "", err
+	}
+	select {
+	case text := <-reply:
+		return text, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// answer hands a message to a pending Ask, reporting whether it was taken
+func (t *TelegramBot) answer(ctx context.Context, msg *telegramIncoming) bool {
+	if strings.HasPrefix(msg.Text, "/") {
+		return false
+	}
+	t.mu.Lock()
+	reply, allowed := t.reply, t.replyAllowed
+	t.mu.Unlock()
+	if reply == nil || (len(allowed) > 0 && !slices.Contains(allowed, msg.From.ID)) {
+		return false
+	}
+
+	select {
+	case reply <- msg.Text:
+	default:
+		return false
+	}
+	if err := t.call(ctx, "deleteMessage", telegramDeleteMessageRequest{ChatID: t.chatID, MessageID: msg.MessageID}, nil); err != nil {
+		log.Printf("Bot could not delete the reply, remove it by hand: %v", err)
+	}
+	return true
+}
+
+// parseCommand splits "/cmd@BotName args" into its name and arguments
+func parseCommand(text string) (string, string, bool) {
+	if !strings.HasPrefix(text, "/") {
+		return "", "", false
+	}
+	cmd, args, _ := strings.Cut(strings.TrimPrefix(text, "/"), " ")
+	cmd, _, _ = strings.Cut(cmd, "@")
+	return strings.ToLower(cmd), strings.TrimSpace(args), cmd != ""
+}
+
+func (t *TelegramBot) getUpdates(ctx context.Context, client *http.Client, offset int64) ([]telegramUpdate, error) {
+	body, err := json.Marshal(telegramGetUpdatesRequest{
+		Offset:         offset,
+		Timeout:        pollTimeout,
+		AllowedUpdates: []string{"message"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		fmt.Sprintf("https://api.telegram.org/bot%s/getUpdates", t.token),
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result telegramGetUpdatesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if !result.OK {
+		return nil, fmt.Errorf("telegram bot getUpdates failed: %s", result.Description)
+	}
+	return result.Result, nil
+}
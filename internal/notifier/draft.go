@@ -0,0 +1,144 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/metrics"
+)
+
+// draftEditInterval throttles edits, Telegram rate limits frequent edits of one message
+const draftEditInterval = 1500 * time.Millisecond
+
+// draftCursor marks a message that is still being written
+const draftCursor = " ▌"
+
+type telegramEditMessageRequest struct {
+	ChatID    int64  `json:"chat_id"`
+	MessageID int64  `json:"message_id"`
+	Text      string `json:"text"`
+}
+
+type telegramResponse struct {
+	OK          bool            `json:"ok"`
+	Description string          `json:"description"`
+	Result      json.RawMessage `json:"result"`
+}
+
+type telegramMessage struct {
+	MessageID int64 `json:"message_id"`
+}
+
+// telegramDraft is a bot message edited via editMessageText
+type telegramDraft struct {
+	bot       *TelegramBot
+	messageID int64
+	text      string
+	lastEdit  time.Time
+	mu        sync.Mutex
+}
+
+// Draft posts text as a placeholder to be edited as content arrives
+func (t *TelegramBot) Draft(ctx context.Context, text string) (Draft, error) {
+	if t == nil || t.token == "" || t.chatID == 0 {
+		return nil, fmt.Errorf("telegram bot is not configured")
+	}
+
+	var msg telegramMessage
+	if err := t.call(ctx, "sendMessage", telegramSendMessageRequest{ChatID: t.chatID, Text: text}, &msg); err != nil {
+		return nil, err
+	}
+	return &telegramDraft{bot: t, messageID: msg.MessageID, text: text, lastEdit: time.Now()}, nil
+}
+
+func (d *telegramDraft) Update(ctx context.Context, text string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if time.Since(d.lastEdit) < draftEditInterval {
+		return nil
+	}
+	// Past the first chunk the visible message no longer changes until Finish
+	text = splitText(text, telegramMaxMessageLen-len([]rune(draftCursor)))[0] + draftCursor
+	return d.edit(ctx, text)
+}
+
+func (d *telegramDraft) Finish(ctx context.Context, text string) (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer func() {
+		metrics.NotifierSends.WithLabelValues(sinkName, metrics.Result(err)).Inc()
+	}()
+
+	chunks := splitText(text, telegramMaxMessageLen)
+	if err := d.edit(ctx, chunks[0]); err != nil {
+		return err
+	}
+	for _, chunk := range chunks[1:] {
+		if err := d.bot.sendOnce(ctx, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// edit replaces the message text, Telegram rejects edits that change nothing
+func (d *telegramDraft) edit(ctx context.Context, text string) error {
+	if text == d.text {
+		return nil
+	}
+
+	err := d.bot.call(ctx, "editMessageText", telegramEditMessageRequest{
+		ChatID:    d.bot.chatID,
+		MessageID: d.messageID,
+		Text:      text,
+	}, nil)
+	d.lastEdit = time.Now()
+	if err != nil {
+		return err
+	}
+	d.text = text
+	return nil
+}
+
+// call invokes a bot API method and decodes its result into out, if not nil
+func (t *TelegramBot) call(ctx context.Context, method string, payload any, out any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		fmt.Sprintf("https://api.telegram.org/bot%s/%s", t.token, method),
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result telegramResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("telegram bot %s: %w", method, err)
+	}
+	if !result.OK {
+		return fmt.Errorf("telegram bot %s failed: %s", method, result.Description)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(result.Result, out)
+}
@@ -6,3 +6,18 @@ import "context"
 type Sender interface {
 	Send(ctx context.Context, text string) error
 }
+
+// Drafter is a Sender that can post a message and keep editing it while its
+// content is still being generated.
+type Drafter interface {
+	Sender
+	Draft(ctx context.Context, text string) (Draft, error)
+}
+
+// Draft is a posted message that is updated in place.
+type Draft interface {
+	// Update replaces the content, updates may be dropped to respect rate limits
+	Update(ctx context.Context, text string) error
+	// Finish writes the final content, sending any overflow as new messages
+	Finish(ctx context.Context, text string) error
+}
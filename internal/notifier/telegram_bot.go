@@ -6,7 +6,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/metrics"
 )
 
 const telegramMaxMessageLen = 3500
@@ -15,6 +18,10 @@ type TelegramBot struct {
 	token  string
 	chatID int64
 	client *http.Client
+	// Pending Ask, answered by the next plain message from an allowed user
+	reply        chan string
+	replyAllowed []int64
+	mu           sync.Mutex
 }
 
 func NewTelegramBot(token string, chatID int64) *TelegramBot {
@@ -31,10 +38,16 @@ type telegramSendMessageRequest struct {
 	ParseMode string `json:"parse_mode,omitempty"`
 }
 
-func (t *TelegramBot) Send(ctx context.Context, text string) error {
+// sinkName labels this notifier in metrics
+const sinkName = "telegram_bot"
+
+func (t *TelegramBot) Send(ctx context.Context, text string) (err error) {
 	if t == nil || t.token == "" || t.chatID == 0 || text == "" {
 		return nil
 	}
+	defer func() {
+		metrics.NotifierSends.WithLabelValues(sinkName, metrics.Result(err)).Inc()
+	}()
 
 	chunks := splitText(text, telegramMaxMessageLen)
 	for _, chunk := range chunks {
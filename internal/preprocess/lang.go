@@ -0,0 +1,106 @@
+package preprocess
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+)
+
+// Language codes reported by DetectLanguage
+const (
+	LangChinese    = "zh"
+	LangJapanese   = "ja"
+	LangKorean     = "ko"
+	LangRussian    = "ru"
+	LangVietnamese = "vi"
+	LangEnglish    = "en"
+	LangUnknown    = "und"
+)
+
+// vietnameseLetters are Latin letters used by Vietnamese and no other monitored language
+const vietnameseLetters = "ăâđêôơưạảấầẩẫậắằẳẵặẹẻẽếềểễệỉịọỏốồổỗộớờởỡợụủứừửữựỳỵỷỹ"
+
+// DetectLanguage guesses the language of text from the scripts it uses.
+// Tickers, links and numbers are Latin in every group, so Latin text only
+// counts as English when no other script is present.
+func DetectLanguage(text string) string {
+	var han, kana, hangul, cyrillic, latin, vietnamese int
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+			if strings.ContainsRune(vietnameseLetters, r) {
+				vietnamese++
+			}
+		}
+	}
+
+	switch {
+	case kana > 0:
+		return LangJapanese
+	case hangul > 0 && hangul >= han:
+		return LangKorean
+	case han > 0:
+		return LangChinese
+	case cyrillic > 0:
+		return LangRussian
+	case vietnamese > 0:
+		return LangVietnamese
+	case latin > 0:
+		return LangEnglish
+	}
+	return LangUnknown
+}
+
+// LanguageMix counts messages per detected language
+func LanguageMix(msgs []model.MessageData) map[string]int {
+	mix := make(map[string]int)
+	for _, msg := range msgs {
+		lang := msg.Lang
+		if lang == "" {
+			lang = DetectLanguage(msg.Text)
+		}
+		mix[lang]++
+	}
+	return mix
+}
+
+// FormatLanguageMix renders a mix as "zh 60% · en 40%", most used first
+func FormatLanguageMix(mix map[string]int) string {
+	total := 0
+	langs := make([]string, 0, len(mix))
+	for lang, n := range mix {
+		total += n
+		langs = append(langs, lang)
+	}
+	sort.Slice(langs, func(i, j int) bool {
+		if mix[langs[i]] != mix[langs[j]] {
+			return mix[langs[i]] > mix[langs[j]]
+		}
+		return langs[i] < langs[j]
+	})
+
+	parts := make([]string, len(langs))
+	for i, lang := range langs {
+		parts[i] = lang + " " + percent(mix[lang], total)
+	}
+	return strings.Join(parts, " · ")
+}
+
+func percent(n, total int) string {
+	if total == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.0f%%", float64(n)*100/float64(total))
+}
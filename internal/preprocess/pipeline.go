@@ -0,0 +1,170 @@
+package preprocess
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+)
+
+// Filter names used as keys in Stats
+const (
+	FilterShort     = "short"
+	FilterBot       = "bot"
+	FilterBlocklist = "blocklist"
+	FilterDuplicate = "duplicate"
+	FilterNearDup   = "near_duplicate"
+	FilterRateCap   = "rate_cap"
+)
+
+// nearDupMinRunes skips near-duplicate detection for texts too short to fingerprint reliably
+const nearDupMinRunes = 10
+
+// Stats counts removed messages per filter
+type Stats map[string]int
+
+// Add merges other into s
+func (s Stats) Add(other Stats) {
+	for name, n := range other {
+		s[name] += n
+	}
+}
+
+// Total returns the number of removed messages
+func (s Stats) Total() int {
+	total := 0
+	for _, n := range s {
+		total += n
+	}
+	return total
+}
+
+// Pipeline drops noise from a window before it reaches the LLM
+type Pipeline struct {
+	minRunes        int
+	dropBots        bool
+	botSenders      map[int64]struct{}
+	blocklist       []*regexp.Regexp
+	maxPerSender    int
+	dedup           bool
+	nearDupDistance int
+}
+
+// NewPipeline builds a pipeline from config. Blocklist patterns are validated on config load.
+func NewPipeline(cfg *config.Config) *Pipeline {
+	f := cfg.Filter
+	p := &Pipeline{
+		minRunes:        f.MinRunes,
+		dropBots:        f.DropBots,
+		botSenders:      make(map[int64]struct{}),
+		maxPerSender:    f.MaxPerSender,
+		dedup:           f.Dedup,
+		nearDupDistance: f.NearDupDistance,
+	}
+	for _, id := range f.BotSenders {
+		p.botSenders[id] = struct{}{}
+	}
+	for _, pattern := range f.Blocklist {
+		p.blocklist = append(p.blocklist, regexp.MustCompile(pattern))
+	}
+	return p
+}
+
+// Run filters msgs in order and reports how many messages each filter removed
+func (p *Pipeline) Run(msgs []model.MessageData) ([]model.MessageData, Stats) {
+	stats := make(Stats)
+	kept := make([]model.MessageData, 0, len(msgs))
+
+	seen := make(map[string]struct{})
+	var fingerprints []uint64
+	perSender := make(map[int64]int)
+
+	for _, msg := range msgs {
+		text := strings.TrimSpace(msg.Text)
+		if len([]rune(text)) < p.minRunes {
+			stats[FilterShort]++
+			continue
+		}
+
+		if p.isBot(msg) {
+			stats[FilterBot]++
+			continue
+		}
+
+		if p.blocked(text) {
+			stats[FilterBlocklist]++
+			continue
+		}
+
+		if p.dedup {
+			key := normalize(text)
+			if _, ok := seen[key]; ok {
+				stats[FilterDuplicate]++
+				continue
+			}
+			seen[key] = struct{}{}
+
+			if p.nearDupDistance > 0 && len([]rune(key)) >= nearDupMinRunes {
+				fp := simhash(key)
+				if nearDuplicate(fp, fingerprints, p.nearDupDistance) {
+					stats[FilterNearDup]++
+					continue
+				}
+				fingerprints = append(fingerprints, fp)
+			}
+		}
+
+		if p.maxPerSender > 0 && msg.SenderID != 0 {
+			if perSender[msg.SenderID] >= p.maxPerSender {
+				stats[FilterRateCap]++
+				continue
+			}
+			perSender[msg.SenderID]++
+		}
+
+		msg.Lang = DetectLanguage(text)
+		kept = append(kept, msg)
+	}
+
+	return kept, stats
+}
+
+func (p *Pipeline) isBot(msg model.MessageData) bool {
+	if !p.dropBots {
+		return false
+	}
+	if msg.SenderIsBot {
+		return true
+	}
+	_, ok := p.botSenders[msg.SenderID]
+	return ok
+}
+
+func (p *Pipeline) blocked(text string) bool {
+	for _, re := range p.blocklist {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize lowercases text and collapses whitespace and punctuation so trivial edits still match
+func normalize(text string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) {
+			space = true
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,53 @@
+package preprocess
+
+import (
+	"hash/fnv"
+	"math/bits"
+)
+
+// shingleSize is the rune n-gram length used for fingerprints
+const shingleSize = 3
+
+// simhash computes a 64-bit fingerprint over rune shingles, similar texts
+// end up with a small Hamming distance
+func simhash(text string) uint64 {
+	runes := []rune(text)
+	if len(runes) < shingleSize {
+		return hashShingle(runes)
+	}
+
+	var weights [64]int
+	for i := 0; i+shingleSize <= len(runes); i++ {
+		h := hashShingle(runes[i : i+shingleSize])
+		for bit := 0; bit < 64; bit++ {
+			if h&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var fp uint64
+	for bit, w := range weights {
+		if w > 0 {
+			fp |= 1 << bit
+		}
+	}
+	return fp
+}
+
+func hashShingle(runes []rune) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(string(runes)))
+	return h.Sum64()
+}
+
+func nearDuplicate(fp uint64, fingerprints []uint64, maxDistance int) bool {
+	for _, other := range fingerprints {
+		if bits.OnesCount64(fp^other) <= maxDistance {
+			return true
+		}
+	}
+	return false
+}
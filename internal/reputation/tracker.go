@@ -0,0 +1,422 @@
+package reputation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/FuradWho/TgRadar-Go/internal/entity"
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+)
+
+// Score weights, they sum to 1
+const (
+	weightActivity = 0.2
+	weightReplies  = 0.3
+	weightHits     = 0.4
+	weightAdmin    = 0.1
+)
+
+// activitySaturation is the message count at which the activity component maxes out
+const activitySaturation = 500
+
+// replyMemory is how many recent message IDs per group are kept to attribute replies across windows
+const replyMemory = 5000
+
+// SenderKey identifies the sender of msg. Users and channels have separate ID
+// namespaces that can collide, so channels are keyed by their negated ID.
+func SenderKey(msg model.MessageData) int64 {
+	if msg.SenderIsChannel {
+		return -msg.SenderID
+	}
+	return msg.SenderID
+}
+
+// Label renders a sender key as U<id> for users and C<id> for channels
+func Label(key int64) string {
+	if key < 0 {
+		return fmt.Sprintf("C%d", -key)
+	}
+	return fmt.Sprintf("U%d", key)
+}
+
+// Sender is the persisted history of a single sender, ID is its SenderKey
+type Sender struct {
+	ID              int64 `json:"id"`
+	Messages        int   `json:"messages"`
+	Windows         int   `json:"windows"`
+	RepliesReceived int   `json:"replies_received"`
+	Calls           int   `json:"calls"`
+	Hits            int   `json:"hits"`
+	// Admin status per group as last observed
+	AdminIn  map[int64]bool `json:"admin_in,omitempty"`
+	LastSeen time.Time      `json:"last_seen"`
+}
+
+// Admin reports whether the sender is an admin of groupID, or of any group
+// when groupID is 0
+func (s *Sender) Admin(groupID int64) bool {
+	if groupID != 0 {
+		return s.AdminIn[groupID]
+	}
+	for _, admin := range s.AdminIn {
+		if admin {
+			return true
+		}
+	}
+	return false
+}
+
+// Score combines activity, reply rate, call hit rate and admin status in
+// groupID into [0, 1]
+func (s *Sender) Score(groupID int64) float64 {
+	activity := math.Min(1, math.Log1p(float64(s.Messages))/math.Log1p(activitySaturation))
+
+	replyRate := 0.0
+	if s.Messages > 0 {
+		replyRate = math.Min(1, float64(s.RepliesReceived)/float64(s.Messages))
+	}
+
+	// Shrink small samples towards zero so one lucky call is not a signal
+	hitRate := float64(s.Hits) / float64(s.Calls+2)
+
+	admin := 0.0
+	if s.Admin(groupID) {
+		admin = 1
+	}
+
+	return weightActivity*activity + weightReplies*replyRate + weightHits*hitRate + weightAdmin*admin
+}
+
+// mention is a ticker mention waiting to see whether the ticker trends later
+type mention struct {
+	SenderID int64     `json:"sender_id"`
+	Time     time.Time `json:"time"`
+	Seq      int       `json:"seq"`
+}
+
+type state struct {
+	Seq     int                  `json:"seq"`
+	Senders map[int64]*Sender    `json:"senders"`
+	Pending map[string][]mention `json:"pending"`
+}
+
+// options tunes how trends and high-signal users are detected
+type options struct {
+	// Distinct senders within one window for a ticker to count as trending
+	trendMinSenders int
+	// How long a mention may wait for its ticker to trend
+	lookback time.Duration
+	// Minimum score and message count to be considered high-signal
+	highSignalScore    float64
+	highSignalMessages int
+}
+
+// Tracker keeps per-sender history across windows
+type Tracker struct {
+	path    string
+	opts    options
+	state   state
+	replies map[int64]map[int]int64 // group -> message ID -> sender
+	mu      sync.Mutex
+}
+
+// FirstMention is the earliest mention of a ticker within a window
+type FirstMention struct {
+	Ticker string
+	// SenderKey of the first sender
+	Sender int64
+	Score  float64
+}
+
+// NewTracker loads history from the configured file, a missing file starts empty
+func NewTracker(cfg *config.Config) (*Tracker, error) {
+	rc := cfg.Reputation
+	t := &Tracker{
+		path: rc.File,
+		opts: options{
+			trendMinSenders:    rc.TrendMinSenders,
+			lookback:           time.Duration(rc.LookbackHours) * time.Hour,
+			highSignalScore:    rc.HighSignalScore,
+			highSignalMessages: rc.HighSignalMessages,
+		},
+		replies: make(map[int64]map[int]int64),
+		state: state{
+			Senders: make(map[int64]*Sender),
+			Pending: make(map[string][]mention),
+		},
+	}
+
+	st, err := load(t.path)
+	if err != nil {
+		return nil, err
+	}
+	if st != nil {
+		t.state = *st
+	}
+	return t, nil
+}
+
+// load reads persisted history, returning nil if the file does not exist
+func load(path string) (*state, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read reputation file: %w", err)
+	}
+
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("parse reputation file: %w", err)
+	}
+	if st.Senders == nil {
+		st.Senders = make(map[int64]*Sender)
+	}
+	if st.Pending == nil {
+		st.Pending = make(map[string][]mention)
+	}
+	return &st, nil
+}
+
+// Observe folds a filtered window into sender history and returns the first
+// mention of every ticker in the window
+func (t *Tracker) Observe(groupID int64, msgs []model.MessageData) []FirstMention {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.state.Seq++
+	seq := t.state.Seq
+
+	replies := t.replies[groupID]
+	if replies == nil {
+		replies = make(map[int]int64)
+		t.replies[groupID] = replies
+	}
+
+	var latest time.Time
+	active := make(map[int64]struct{})
+	tickerSenders := make(map[string]map[int64]time.Time)
+	var order []string
+
+	for _, msg := range msgs {
+		if msg.Timestamp.After(latest) {
+			latest = msg.Timestamp
+		}
+		if msg.SenderID == 0 {
+			continue
+		}
+		key := SenderKey(msg)
+
+		rec := t.sender(key)
+		rec.Messages++
+		rec.LastSeen = msg.Timestamp
+		// Admins get demoted, keep the latest status rather than any ever seen
+		if msg.SenderIsAdmin {
+			if rec.AdminIn == nil {
+				rec.AdminIn = make(map[int64]bool)
+			}
+			rec.AdminIn[groupID] = true
+		} else {
+			delete(rec.AdminIn, groupID)
+		}
+		active[key] = struct{}{}
+
+		if msg.ReplyToMsgID != 0 {
+			if target, ok := replies[msg.ReplyToMsgID]; ok && target != key {
+				t.sender(target).RepliesReceived++
+			}
+		}
+		if msg.MsgID != 0 && len(replies) < replyMemory {
+			replies[msg.MsgID] = key
+		}
+
+		for _, ticker := range entity.Extract(msg.Text).Tickers {
+			senders, ok := tickerSenders[ticker]
+			if !ok {
+				senders = make(map[int64]time.Time)
+				tickerSenders[ticker] = senders
+				order = append(order, ticker)
+			}
+			if _, ok := senders[key]; !ok {
+				senders[key] = msg.Timestamp
+			}
+		}
+	}
+	if len(replies) >= replyMemory {
+		// Forget old message IDs wholesale rather than tracking age
+		t.replies[groupID] = make(map[int]int64)
+	}
+
+	for id := range active {
+		t.state.Senders[id].Windows++
+	}
+
+	var firsts []FirstMention
+	for _, ticker := range order {
+		senders := tickerSenders[ticker]
+
+		first := FirstMention{Ticker: ticker}
+		var firstTime time.Time
+		for id, ts := range senders {
+			if firstTime.IsZero() || ts.Before(firstTime) {
+				firstTime = ts
+				first.Sender = id
+			}
+		}
+		first.Score = t.state.Senders[first.Sender].Score(groupID)
+		firsts = append(firsts, first)
+
+		if len(senders) >= t.opts.trendMinSenders {
+			t.creditTrend(ticker, seq)
+			continue
+		}
+		t.addPending(ticker, senders, seq)
+	}
+
+	t.prune(latest)
+	return firsts
+}
+
+// creditTrend rewards everyone who mentioned ticker in an earlier window
+func (t *Tracker) creditTrend(ticker string, seq int) {
+	var keep []mention
+	for _, m := range t.state.Pending[ticker] {
+		if m.Seq >= seq {
+			keep = append(keep, m)
+			continue
+		}
+		t.sender(m.SenderID).Hits++
+	}
+	if len(keep) == 0 {
+		delete(t.state.Pending, ticker)
+		return
+	}
+	t.state.Pending[ticker] = keep
+}
+
+func (t *Tracker) addPending(ticker string, senders map[int64]time.Time, seq int) {
+	for id, ts := range senders {
+		already := false
+		for _, m := range t.state.Pending[ticker] {
+			if m.SenderID == id {
+				already = true
+				break
+			}
+		}
+		if already {
+			continue
+		}
+		t.state.Pending[ticker] = append(t.state.Pending[ticker], mention{SenderID: id, Time: ts, Seq: seq})
+		t.sender(id).Calls++
+	}
+}
+
+// prune drops mentions that waited longer than the lookback without trending
+func (t *Tracker) prune(now time.Time) {
+	if t.opts.lookback <= 0 || now.IsZero() {
+		return
+	}
+	cutoff := now.Add(-t.opts.lookback)
+	for ticker, mentions := range t.state.Pending {
+		var keep []mention
+		for _, m := range mentions {
+			if m.Time.After(cutoff) {
+				keep = append(keep, m)
+			}
+		}
+		if len(keep) == 0 {
+			delete(t.state.Pending, ticker)
+		} else {
+			t.state.Pending[ticker] = keep
+		}
+	}
+}
+
+func (t *Tracker) sender(id int64) *Sender {
+	rec, ok := t.state.Senders[id]
+	if !ok {
+		rec = &Sender{ID: id}
+		t.state.Senders[id] = rec
+	}
+	return rec
+}
+
+// Score returns the reputation score of a sender key in groupID, 0 for
+// unknown senders
+func (t *Tracker) Score(groupID, key int64) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if rec, ok := t.state.Senders[key]; ok {
+		return rec.Score(groupID)
+	}
+	return 0
+}
+
+// HighSignal reports whether a sender key has enough history and a high
+// enough score in groupID
+func (t *Tracker) HighSignal(groupID, key int64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rec, ok := t.state.Senders[key]
+	if !ok {
+		return false
+	}
+	return rec.Messages >= t.opts.highSignalMessages && rec.Score(groupID) >= t.opts.highSignalScore
+}
+
+// Save persists history atomically
+func (t *Tracker) Save() error {
+	t.mu.Lock()
+	data, err := json.Marshal(t.state)
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write reputation file: %w", err)
+	}
+	return os.Rename(tmp, t.path)
+}
+
+// Sender returns a copy of the history of a sender key
+func (t *Tracker) Sender(id int64) (Sender, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rec, ok := t.state.Senders[id]
+	if !ok {
+		return Sender{}, false
+	}
+	return *rec, true
+}
+
+// Top returns senders ordered by score with admin status in any group,
+// highest first
+func (t *Tracker) Top(limit int) []Sender {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	senders := make([]Sender, 0, len(t.state.Senders))
+	for _, rec := range t.state.Senders {
+		senders = append(senders, *rec)
+	}
+	sort.Slice(senders, func(i, j int) bool {
+		return senders[i].Score(0) > senders[j].Score(0)
+	})
+	if limit > 0 && len(senders) > limit {
+		senders = senders[:limit]
+	}
+	return senders
+}
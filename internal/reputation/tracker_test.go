@@ -0,0 +1,62 @@
+package reputation
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+)
+
+func newTestTracker(t *testing.T) *Tracker {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Reputation.File = filepath.Join(t.TempDir(), "reputation.json")
+	cfg.Reputation.TrendMinSenders = 3
+	tracker, err := NewTracker(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tracker
+}
+
+func TestAdminPerGroupLatest(t *testing.T) {
+	tracker := newTestTracker(t)
+	now := time.Now()
+	tracker.Observe(1, []model.MessageData{{SenderID: 10, SenderIsAdmin: true, Text: "hi", Timestamp: now}})
+	tracker.Observe(2, []model.MessageData{{SenderID: 10, Text: "hi", Timestamp: now}})
+
+	rec, _ := tracker.Sender(10)
+	if !rec.Admin(1) || rec.Admin(2) || !rec.Admin(0) {
+		t.Fatalf("admin in 1, 2, any = %v %v %v, want true false true", rec.Admin(1), rec.Admin(2), rec.Admin(0))
+	}
+	if tracker.Score(1, 10) <= tracker.Score(2, 10) {
+		t.Error("admin status does not raise the score in its own group only")
+	}
+
+	// Demoted since, the latest status wins
+	tracker.Observe(1, []model.MessageData{{SenderID: 10, Text: "hi", Timestamp: now}})
+	if rec, _ := tracker.Sender(10); rec.Admin(1) || rec.Admin(0) {
+		t.Error("admin status kept after a message without it")
+	}
+}
+
+func TestChannelSendersApartFromUsers(t *testing.T) {
+	tracker := newTestTracker(t)
+	now := time.Now()
+	tracker.Observe(1, []model.MessageData{
+		{SenderID: 42, Text: "user", Timestamp: now},
+		{SenderID: 42, SenderIsChannel: true, Text: "channel", Timestamp: now},
+		{SenderID: 42, SenderIsChannel: true, Text: "channel", Timestamp: now},
+	})
+
+	user, _ := tracker.Sender(42)
+	channel, ok := tracker.Sender(-42)
+	if !ok || user.Messages != 1 || channel.Messages != 2 {
+		t.Fatalf("user %+v channel %+v, want 1 and 2 messages", user, channel)
+	}
+	if Label(user.ID) != "U42" || Label(channel.ID) != "C42" {
+		t.Errorf("labels %s %s, want U42 C42", Label(user.ID), Label(channel.ID))
+	}
+}
@@ -0,0 +1,264 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/ai"
+	"github.com/FuradWho/TgRadar-Go/internal/entity"
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+	"github.com/FuradWho/TgRadar-Go/internal/store"
+)
+
+// Retrieval limits for a question
+const (
+	askLookback        = 24 * time.Hour
+	askMaxMessages     = 60
+	askPerSourceLimit  = 30
+	askMaxReports      = 6
+	askReportScanLimit = 100
+	askReportRunes     = 800
+)
+
+// citationPattern matches [G<group>#<msg>] and [R<report>] labels in answers
+var citationPattern = regexp.MustCompile(`\[(?:G(-?\d+)#(\d+)|R(\d+))\]`)
+
+// Citation is a source the answer refers to
+type Citation struct {
+	Label    string    `json:"label"`
+	GroupID  int64     `json:"group_id"`
+	MsgID    int       `json:"msg_id,omitempty"`
+	ReportID int64     `json:"report_id,omitempty"`
+	Text     string    `json:"text"`
+	Time     time.Time `json:"time"`
+}
+
+// Answer is the reply to a question along with the sources it cites
+type Answer struct {
+	Question  string     `json:"question"`
+	Answer    string     `json:"answer"`
+	Citations []Citation `json:"citations"`
+	Provider  string     `json:"provider"`
+	Model     string     `json:"model"`
+}
+
+// Ask answers a question from the archived messages and reports matching f,
+// the last day unless f sets a time range
+func (s *Searcher) Ask(ctx context.Context, question string, f store.MessageFilter) (Answer, error) {
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return Answer{}, fmt.Errorf("empty question")
+	}
+	if s.overBudget(ctx) {
+		return Answer{}, ErrOverBudget
+	}
+	if f.From.IsZero() {
+		end := f.To
+		if end.IsZero() {
+			end = time.Now()
+		}
+		f.From = end.Add(-askLookback)
+	}
+
+	msgs, err := s.retrieveMessages(ctx, question, f)
+	if err != nil {
+		return Answer{}, err
+	}
+	reports, err := s.retrieveReports(ctx, question, f)
+	if err != nil {
+		return Answer{}, err
+	}
+	if len(msgs) == 0 && len(reports) == 0 {
+		return Answer{Question: question, Answer: "没有找到相关的消息或报告", Citations: []Citation{}}, nil
+	}
+
+	sources := make(map[string]Citation)
+	var b strings.Builder
+	if len(msgs) > 0 {
+		b.WriteString("## 群聊消息\n")
+		for _, hit := range msgs {
+			c := messageCitation(hit)
+			sources[c.Label] = c
+			b.WriteString(fmt.Sprintf("%s %s %s: %s\n", c.Label, c.Time.Format("01-02 15:04"), sender(hit), hit.Message.Text))
+		}
+	}
+	if len(reports) > 0 {
+		b.WriteString("\n## 历史报告\n")
+		for _, r := range reports {
+			c := reportCitation(r)
+			sources[c.Label] = c
+			b.WriteString(fmt.Sprintf("%s %s（%s ~ %s）:\n%s\n\n", c.Label, reportName(r.GroupID),
+				r.WindowStart.Format("01-02 15:04"), r.WindowEnd.Format("15:04"), truncate(r.Content, askReportRunes)))
+		}
+	}
+
+	start := time.Now()
+	result, err := s.aiClient.Ask(ctx, question, strings.TrimSpace(b.String()))
+	if err != nil {
+		return Answer{}, err
+	}
+	s.recordUsage(ctx, ai.StageAsk, result, start)
+
+	return Answer{
+		Question:  question,
+		Answer:    result.Content,
+		Citations: cited(result.Content, sources),
+		Provider:  result.Provider,
+		Model:     result.Model,
+	}, nil
+}
+
+// retrieveMessages collects candidates by semantic similarity, mentioned
+// entities and full-text match, topped up with the latest messages, in time order
+func (s *Searcher) retrieveMessages(ctx context.Context, question string, f store.MessageFilter) ([]store.MessageHit, error) {
+	seen := make(map[int64]bool)
+	var msgs []store.MessageHit
+	add := func(hits []store.MessageHit) {
+		for _, hit := range hits {
+			if len(msgs) < askMaxMessages && !seen[hit.ID] {
+				seen[hit.ID] = true
+				msgs = append(msgs, hit)
+			}
+		}
+	}
+
+	if s.aiClient.EmbeddingModel() != "" {
+		hits, err := s.semantic(ctx, Query{Text: question, MessageFilter: f, Semantic: true, Limit: askPerSourceLimit})
+		if err != nil {
+			log.Printf("Ask semantic retrieval failed: %v", err)
+		}
+		add(hits)
+	}
+
+	for _, symbol := range entity.Extract(question).Symbols() {
+		ef := f
+		ef.Entity = symbol
+		hits, err := s.store.SearchMessages(ctx, "", ef, askPerSourceLimit)
+		if err != nil {
+			return nil, err
+		}
+		add(hits)
+	}
+
+	// Space separated keywords, useless for single-token CJK questions but cheap
+	if hits, err := s.store.SearchMessages(ctx, question, f, askPerSourceLimit); err == nil {
+		add(hits)
+	}
+
+	if len(msgs) < askPerSourceLimit {
+		hits, err := s.store.SearchMessages(ctx, "", f, askPerSourceLimit)
+		if err != nil {
+			return nil, err
+		}
+		add(hits)
+	}
+
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].Message.Timestamp.Before(msgs[j].Message.Timestamp) })
+	return msgs, nil
+}
+
+// retrieveReports picks the latest reports of the filtered group and time
+// range, preferring those mentioning an entity of the question
+func (s *Searcher) retrieveReports(ctx context.Context, question string, f store.MessageFilter) ([]store.Report, error) {
+	reports, err := s.store.ReportsBetween(ctx, f.GroupID, f.From, f.To, askReportScanLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := entity.Extract(question).Symbols()
+	var relevant, rest []store.Report
+	for _, r := range reports {
+		if mentionsAny(r.Content, symbols) {
+			relevant = append(relevant, r)
+		} else {
+			rest = append(rest, r)
+		}
+	}
+
+	picked := append(relevant, rest...)
+	if len(picked) > askMaxReports {
+		picked = picked[:askMaxReports]
+	}
+	return picked, nil
+}
+
+// cited returns the sources the answer refers to, in order of first mention
+func cited(answer string, sources map[string]Citation) []Citation {
+	citations := []Citation{}
+	seen := make(map[string]bool)
+	for _, m := range citationPattern.FindAllString(answer, -1) {
+		if c, ok := sources[m]; ok && !seen[m] {
+			seen[m] = true
+			citations = append(citations, c)
+		}
+	}
+	return citations
+}
+
+func messageCitation(hit store.MessageHit) Citation {
+	msg := hit.Message
+	return Citation{
+		Label:   fmt.Sprintf("[G%d#%d]", msg.GroupID, msg.MsgID),
+		GroupID: msg.GroupID,
+		MsgID:   msg.MsgID,
+		Text:    msg.Text,
+		Time:    msg.Timestamp,
+	}
+}
+
+func reportCitation(r store.Report) Citation {
+	return Citation{
+		Label:    "[R" + strconv.FormatInt(r.ID, 10) + "]",
+		GroupID:  r.GroupID,
+		ReportID: r.ID,
+		Text:     truncate(r.Content, askReportRunes),
+		Time:     r.WindowEnd,
+	}
+}
+
+func reportName(groupID int64) string {
+	if groupID == store.GlobalGroupID {
+		return "全局汇总"
+	}
+	return fmt.Sprintf("群组 %d", groupID)
+}
+
+func sender(hit store.MessageHit) string {
+	// Channel posts all come from the channel, their reach matters instead
+	if msg := hit.Message; msg.Source == model.SourceChannel {
+		return fmt.Sprintf("📢 (👁 %d ↗ %d)", msg.Views, msg.Forwards)
+	}
+	if hit.Message.SenderID == 0 {
+		return "U?"
+	}
+	return fmt.Sprintf("U%d", hit.Message.SenderID)
+}
+
+func mentionsAny(text string, symbols []string) bool {
+	upper := strings.ToUpper(text)
+	for _, symbol := range symbols {
+		if strings.Contains(upper, strings.ToUpper(symbol)) {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatAnswer renders an answer and its sources for the bot and the command line
+func FormatAnswer(a Answer) string {
+	var b strings.Builder
+	b.WriteString(a.Answer)
+	if len(a.Citations) > 0 {
+		b.WriteString("\n\n📎 来源：")
+		for _, c := range a.Citations {
+			b.WriteString(fmt.Sprintf("\n%s %s %s", c.Label, c.Time.Format("01-02 15:04"), truncate(strings.ReplaceAll(c.Text, "\n", " "), 80)))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,73 @@
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseQuery parses the /search syntax: free text plus optional filters
+//
+//	group:<id> sender:<id> entity:<ticker or contract> from:<time> to:<time>
+//	day:<YYYY-MM-DD> limit:<n> mode:semantic
+//
+// Times are RFC 3339 or YYYY-MM-DD, to is exclusive.
+func ParseQuery(text string) (Query, error) {
+	var q Query
+	var terms []string
+	for _, token := range strings.Fields(text) {
+		key, value, ok := strings.Cut(token, ":")
+		if !ok || value == "" {
+			terms = append(terms, token)
+			continue
+		}
+
+		var err error
+		switch strings.ToLower(key) {
+		case "group":
+			q.GroupID, err = strconv.ParseInt(value, 10, 64)
+		case "sender":
+			q.SenderID, err = strconv.ParseInt(strings.TrimPrefix(value, "U"), 10, 64)
+		case "entity", "ticker":
+			q.Entity = NormalizeEntity(value)
+		case "from", "since":
+			q.From, err = ParseTime(value)
+		case "to", "until":
+			q.To, err = ParseTime(value)
+		case "day":
+			q.From, err = ParseTime(value)
+			q.To = q.From.AddDate(0, 0, 1)
+		case "limit":
+			q.Limit, err = strconv.Atoi(value)
+		case "mode":
+			q.Semantic = strings.EqualFold(value, "semantic")
+		default:
+			// Not a filter, e.g. a URL
+			terms = append(terms, token)
+		}
+		if err != nil {
+			return q, fmt.Errorf("invalid %s: %q", key, value)
+		}
+	}
+	q.Text = strings.Join(terms, " ")
+	return q, nil
+}
+
+// ParseTime accepts RFC 3339 timestamps and local dates
+func ParseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+// NormalizeEntity matches the archived form: tickers upper case without $,
+// contract addresses unchanged
+func NormalizeEntity(value string) string {
+	value = strings.TrimPrefix(value, "$")
+	if strings.HasPrefix(value, "0x") || len(value) > 20 {
+		return value
+	}
+	return strings.ToUpper(value)
+}
@@ -0,0 +1,304 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/ai"
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/FuradWho/TgRadar-Go/internal/cost"
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+	"github.com/FuradWho/TgRadar-Go/internal/store"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// Embedding batches and how often new messages are checked for
+const (
+	embedBatchSize = 64
+	indexInterval  = 30 * time.Second
+)
+
+// Messages the embedding model rejects are retried after embedRetryBackoff,
+// doubling each time, and skipped for good after embedMaxAttempts. Retrying
+// one message at a time stops after embedMaxSingleFailures in a row, as the
+// provider is then more likely down than the messages bad.
+const (
+	embedRetryBackoff      = time.Minute
+	embedMaxAttempts       = 8
+	embedMaxSingleFailures = 3
+)
+
+var (
+	// ErrSemanticDisabled is returned for semantic queries without an embedding model
+	ErrSemanticDisabled = errors.New("semantic search needs ai.embedding.model")
+	// ErrOverBudget is returned instead of calling the LLM once the budget is used up
+	ErrOverBudget = errors.New("LLM budget used up")
+)
+
+// Query is a search over archived messages
+type Query struct {
+	Text string
+	store.MessageFilter
+	// Rank by embedding similarity instead of full-text match
+	Semantic bool
+	Limit    int
+}
+
+// Searcher answers full-text and semantic queries over archived messages
+type Searcher struct {
+	cfg      *config.Config
+	store    *store.Store
+	aiClient *ai.Client
+	// Records LLM usage and enforces the budget, nil without storage
+	cost *cost.Tracker
+}
+
+func NewSearcher(cfg *config.Config, store *store.Store, aiClient *ai.Client, cost *cost.Tracker) *Searcher {
+	return &Searcher{cfg: cfg, store: store, aiClient: aiClient, cost: cost}
+}
+
+// Search returns the best matching messages
+func (s *Searcher) Search(ctx context.Context, q Query) ([]store.MessageHit, error) {
+	if strings.TrimSpace(q.Text) == "" && (q.Semantic || q.MessageFilter == store.MessageFilter{}) {
+		return nil, fmt.Errorf("empty query")
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultLimit
+	}
+	q.Limit = min(q.Limit, MaxLimit)
+
+	if q.Semantic {
+		return s.semantic(ctx, q)
+	}
+	return s.store.SearchMessages(ctx, q.Text, q.MessageFilter, q.Limit)
+}
+
+// semantic ranks filtered messages by cosine similarity to the query
+func (s *Searcher) semantic(ctx context.Context, q Query) ([]store.MessageHit, error) {
+	model := s.aiClient.EmbeddingModel()
+	if model == "" {
+		return nil, ErrSemanticDisabled
+	}
+
+	if s.overBudget(ctx) {
+		return nil, ErrOverBudget
+	}
+	vectors, err := s.embed(ctx, []string{q.Text})
+	if err != nil {
+		return nil, fmt.Errorf("embed query: %w", err)
+	}
+	query := vectors[0]
+
+	var hits []store.MessageHit
+	err = s.store.EachEmbedding(ctx, model, q.MessageFilter, func(hit store.MessageHit, vector []float32) error {
+		hit.Score = Cosine(query, vector)
+		hits = append(hits, hit)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if len(hits) > q.Limit {
+		hits = hits[:q.Limit]
+	}
+	return hits, nil
+}
+
+// Run embeds newly archived messages in the background until ctx is cancelled
+func (s *Searcher) Run(ctx context.Context) {
+	model := s.aiClient.EmbeddingModel()
+	if model == "" {
+		return
+	}
+
+	ticker := time.NewTicker(indexInterval)
+	defer ticker.Stop()
+	paused := false
+	for {
+		over := s.overBudget(ctx)
+		if over && !paused {
+			log.Printf("Embedding index paused, LLM budget used up")
+		} else if !over && paused {
+			log.Printf("Embedding index resumed")
+		}
+		paused = over
+		if !over {
+			if err := s.index(ctx, model); err != nil && ctx.Err() == nil {
+				log.Printf("Embedding index failed: %v", err)
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// index embeds messages in batches until none are left. A batch that fails
+// is retried one message at a time so a message the model rejects is put
+// aside instead of holding up the rest.
+func (s *Searcher) index(ctx context.Context, model string) error {
+	for {
+		batch, err := s.store.UnembeddedMessages(ctx, model, embedBatchSize, embedMaxAttempts, time.Now())
+		if err != nil || len(batch) == 0 {
+			return err
+		}
+
+		ids := make([]int64, len(batch))
+		texts := make([]string, len(batch))
+		for i, hit := range batch {
+			ids[i] = hit.ID
+			texts[i] = hit.Message.Text
+		}
+		vectors, err := s.embed(ctx, texts)
+		if err == nil {
+			if err := s.store.SaveEmbeddings(ctx, model, ids, vectors); err != nil {
+				return err
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		if err := s.indexEach(ctx, model, batch); err != nil {
+			return err
+		}
+	}
+}
+
+// indexEach embeds messages one by one, recording those that fail
+func (s *Searcher) indexEach(ctx context.Context, model string, batch []store.MessageHit) error {
+	var failed []int64
+	var lastErr error
+	inRow := 0
+	for _, hit := range batch {
+		vectors, err := s.embed(ctx, []string{hit.Message.Text})
+		if err == nil {
+			inRow = 0
+			err = s.store.SaveEmbeddings(ctx, model, []int64{hit.ID}, vectors)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		failed = append(failed, hit.ID)
+		lastErr, inRow = err, inRow+1
+		if inRow >= embedMaxSingleFailures {
+			break
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+
+	log.Printf("Embedding failed for %d messages, retrying later: %v", len(failed), lastErr)
+	if err := s.store.RecordEmbeddingFailures(ctx, model, failed, time.Now(), embedRetryBackoff); err != nil {
+		return err
+	}
+	if inRow >= embedMaxSingleFailures {
+		return lastErr
+	}
+	return nil
+}
+
+// embed embeds texts and records the usage
+func (s *Searcher) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	start := time.Now()
+	vectors, result, err := s.aiClient.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	s.recordUsage(ctx, ai.StageEmbedding, result, start)
+	return vectors, nil
+}
+
+// recordUsage attributes the tokens of one call to the global group
+func (s *Searcher) recordUsage(ctx context.Context, stage string, result ai.Result, start time.Time) {
+	if s.cost == nil {
+		return
+	}
+	if err := s.cost.Record(ctx, store.GlobalGroupID, stage, result, start, time.Now()); err != nil {
+		log.Printf("Usage record failed: %v", err)
+	}
+}
+
+// overBudget reports whether the LLM budget is used up
+func (s *Searcher) overBudget(ctx context.Context) bool {
+	if s.cost == nil {
+		return false
+	}
+	over, err := s.cost.OverBudget(ctx, time.Now())
+	if err != nil {
+		log.Printf("Budget check failed: %v", err)
+		return false
+	}
+	return over
+}
+
+// Cosine returns the cosine similarity of two vectors
+func Cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range min(len(a), len(b)) {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// FormatHits renders hits for the bot and the command line
+func FormatHits(hits []store.MessageHit) string {
+	if len(hits) == 0 {
+		return "No matching messages"
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("🔎 %d results\n", len(hits)))
+	for _, hit := range hits {
+		msg := hit.Message
+		group := fmt.Sprintf("%d", msg.GroupID)
+		if msg.GroupTitle != "" {
+			group = msg.GroupTitle
+		}
+		sender := "U?"
+		if msg.SenderID != 0 {
+			sender = fmt.Sprintf("U%d", msg.SenderID)
+		}
+		if msg.SenderName != "" {
+			sender += " " + msg.SenderName
+		}
+		if msg.Source == model.SourceChannel {
+			sender = fmt.Sprintf("📢 %s (👁 %d ↗ %d)", msg.SenderName, msg.Views, msg.Forwards)
+		}
+		b.WriteString(fmt.Sprintf("\n[%s #%d] %s %s: %s\n",
+			group, msg.MsgID, msg.Timestamp.Format("2006-01-02 15:04"), sender, truncate(msg.Text, 200)))
+	}
+	return b.String()
+}
+
+func truncate(text string, maxRunes int) string {
+	runes := []rune(text)
+	if len(runes) <= maxRunes {
+		return text
+	}
+	return string(runes[:maxRunes]) + "…"
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/entity"
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+)
+
+// SaveMessage archives a raw message along with the entities it mentions
+func (s *Store) SaveMessage(ctx context.Context, msg model.MessageData) error {
+	entities := ""
+	if e := entity.Extract(msg.Text); !e.Empty() {
+		entities = " " + strings.Join(append(e.Tickers, e.Contracts...), " ") + " "
+	}
+
+	reactions, err := encodeReactions(msg.Reactions)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO messages (group_id, group_title, msg_id, reply_to_msg_id, sender_id, sender_name,
+		 sender_username, sender_is_bot, sender_is_admin, text, timestamp, entities, account, source, views, forwards,
+		 reactions, replies, late)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		msg.GroupID, msg.GroupTitle, msg.MsgID, msg.ReplyToMsgID, msg.SenderID, msg.SenderName,
+		msg.SenderUsername, msg.SenderIsBot, msg.SenderIsAdmin, msg.Text, msg.Timestamp.UnixMilli(), entities,
+		msg.Account, msg.Source, msg.Views, msg.Forwards, reactions, msg.Replies, msg.Late,
+	)
+	if err != nil {
+		return fmt.Errorf("save message: %w", err)
+	}
+	return nil
+}
+
+// UpdateEngagement stores the latest reactions, views, forwards and replies
+// of archived messages. Messages are matched by group, ID and time, and
+// outside channels and supergroups by account too, as other chats number
+// messages per account.
+func (s *Store) UpdateEngagement(ctx context.Context, msgs []model.MessageData) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, msg := range msgs {
+		if msg.MsgID == 0 {
+			continue
+		}
+		reactions, err := encodeReactions(msg.Reactions)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE messages SET reactions = ?, views = ?, forwards = ?, replies = ?
+			 WHERE group_id = ? AND timestamp = ? AND msg_id = ?
+			   AND (source IN (?, ?) OR account = ?)`,
+			reactions, msg.Views, msg.Forwards, msg.Replies,
+			msg.GroupID, msg.Timestamp.UnixMilli(), msg.MsgID,
+			model.SourceChannel, model.SourceSupergroup, msg.Account,
+		); err != nil {
+			return fmt.Errorf("update engagement: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// encodeReactions stores reaction counts as JSON, empty when there are none
+func encodeReactions(reactions map[string]int) (string, error) {
+	if len(reactions) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(reactions)
+	if err != nil {
+		return "", fmt.Errorf("encode reactions: %w", err)
+	}
+	return string(data), nil
+}
+
+// EachMessage calls fn for every archived message sent in [from, to) in time
+// order, limited to one group unless groupID is 0. Iteration stops at the
+// first error fn returns. fn must not use the store, the rows hold its only
+// connection.
+func (s *Store) EachMessage(ctx context.Context, groupID int64, from, to time.Time, fn func(model.MessageData) error) error {
+	f := MessageFilter{GroupID: groupID, From: from, To: to}
+	where, args := f.where()
+	query := `SELECT ` + messageColumns + ` FROM messages m WHERE 1 = 1`
+	for _, cond := range where {
+		query += " AND " + cond
+	}
+	query += ` ORDER BY m.timestamp, m.id`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("query messages: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var msg model.MessageData
+		if err := scanMessage(rows, &id, &msg); err != nil {
+			return err
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
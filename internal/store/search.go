@@ -0,0 +1,298 @@
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+)
+
+// minTrigramRunes is the shortest term the trigram index can match, shorter
+// terms fall back to a LIKE scan
+const minTrigramRunes = 3
+
+// MessageFilter narrows a message search, zero values match everything
+type MessageFilter struct {
+	GroupID  int64
+	SenderID int64
+	From     time.Time
+	To       time.Time
+	// Ticker or contract address mentioned in the message
+	Entity string
+}
+
+// MessageHit is an archived message matched by a search
+type MessageHit struct {
+	ID      int64             `json:"id"`
+	Score   float64           `json:"score"`
+	Message model.MessageData `json:"message"`
+}
+
+const messageColumns = `m.id, m.group_id, m.group_title, m.msg_id, m.reply_to_msg_id, m.sender_id, m.sender_name,
+	m.sender_username, m.sender_is_bot, m.sender_is_admin, m.text, m.timestamp, m.account,
+	m.source, m.views, m.forwards, m.reactions, m.replies, m.late`
+
+// SearchMessages finds messages containing every term of query, best matches
+// first. Terms too short for the index are matched with LIKE.
+func (s *Store) SearchMessages(ctx context.Context, query string, f MessageFilter, limit int) ([]MessageHit, error) {
+	var match []string
+	where, args := f.where()
+	for _, term := range strings.Fields(query) {
+		if utf8.RuneCountInString(term) >= minTrigramRunes {
+			match = append(match, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+			continue
+		}
+		where = append(where, `m.text LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(term)+"%")
+	}
+
+	var sqlQuery string
+	if len(match) > 0 {
+		sqlQuery = `SELECT ` + messageColumns + `, -bm25(messages_fts)
+			FROM messages_fts JOIN messages m ON m.id = messages_fts.rowid
+			WHERE messages_fts MATCH ?`
+		args = append([]any{strings.Join(match, " ")}, args...)
+	} else {
+		sqlQuery = `SELECT ` + messageColumns + `, 0 FROM messages m WHERE 1 = 1`
+	}
+	for _, cond := range where {
+		sqlQuery += " AND " + cond
+	}
+	if len(match) > 0 {
+		sqlQuery += ` ORDER BY bm25(messages_fts), m.timestamp DESC LIMIT ?`
+	} else {
+		sqlQuery += ` ORDER BY m.timestamp DESC LIMIT ?`
+	}
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("search messages: %w", err)
+	}
+	defer rows.Close()
+
+	var hits []MessageHit
+	for rows.Next() {
+		var hit MessageHit
+		if err := scanMessage(rows, &hit.ID, &hit.Message, &hit.Score); err != nil {
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+// UnembeddedMessages returns up to limit messages without an embedding from
+// model. Messages that failed to embed are left out until their retry time,
+// and for good after maxAttempts failures.
+func (s *Store) UnembeddedMessages(ctx context.Context, model string, limit, maxAttempts int, now time.Time) ([]MessageHit, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+messageColumns+`, 0 FROM messages m
+		 LEFT JOIN message_embeddings e ON e.message_id = m.id
+		 LEFT JOIN embedding_failures f ON f.message_id = m.id AND f.model = ?
+		 WHERE (e.message_id IS NULL OR e.model != ?)
+		   AND (f.message_id IS NULL OR (f.attempts < ? AND f.retry_at <= ?))
+		 ORDER BY m.id LIMIT ?`,
+		model, model, maxAttempts, now.UnixMilli(), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query unembedded messages: %w", err)
+	}
+	defer rows.Close()
+
+	var hits []MessageHit
+	for rows.Next() {
+		var hit MessageHit
+		if err := scanMessage(rows, &hit.ID, &hit.Message, &hit.Score); err != nil {
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+// SaveEmbeddings stores the embedding of each message, replacing older ones
+func (s *Store) SaveEmbeddings(ctx context.Context, model string, ids []int64, vectors [][]float32) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i, id := range ids {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT OR REPLACE INTO message_embeddings (message_id, model, vector) VALUES (?, ?, ?)`,
+			id, model, encodeVector(vectors[i]),
+		); err != nil {
+			return fmt.Errorf("save embedding: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// RecordEmbeddingFailures counts a failed embedding attempt for each message,
+// the retry delay starting at backoff and doubling with every attempt
+func (s *Store) RecordEmbeddingFailures(ctx context.Context, model string, ids []int64, now time.Time, backoff time.Duration) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range ids {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO embedding_failures (message_id, model, attempts, retry_at) VALUES (?, ?, 1, ?)
+			 ON CONFLICT (message_id, model) DO UPDATE SET
+				attempts = attempts + 1, retry_at = ? + (? << min(attempts, 16))`,
+			id, model, now.Add(backoff).UnixMilli(), now.UnixMilli(), backoff.Milliseconds(),
+		); err != nil {
+			return fmt.Errorf("record embedding failure: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// MessageKey identifies a message within its group
+type MessageKey struct {
+	GroupID int64
+	MsgID   int
+}
+
+// EmbeddingsBetween returns the embeddings from model of messages sent in
+// [from, to] with the text they were computed from
+func (s *Store) EmbeddingsBetween(ctx context.Context, model string, from, to time.Time) (map[MessageKey]Embedding, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT m.group_id, m.msg_id, m.text, e.vector FROM messages m
+		 JOIN message_embeddings e ON e.message_id = m.id
+		 WHERE e.model = ? AND m.timestamp >= ? AND m.timestamp <= ?`,
+		model, from.UnixMilli(), to.UnixMilli(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	embeddings := make(map[MessageKey]Embedding)
+	for rows.Next() {
+		var key MessageKey
+		var text string
+		var blob []byte
+		if err := rows.Scan(&key.GroupID, &key.MsgID, &text, &blob); err != nil {
+			return nil, err
+		}
+		embeddings[key] = Embedding{Text: text, Vector: decodeVector(blob)}
+	}
+	return embeddings, rows.Err()
+}
+
+// Embedding is a stored vector and the text it was computed from
+type Embedding struct {
+	Text   string
+	Vector []float32
+}
+
+// EachEmbedding calls fn for every message matching f that has an embedding
+// from model. fn must not use the store.
+func (s *Store) EachEmbedding(ctx context.Context, model string, f MessageFilter, fn func(MessageHit, []float32) error) error {
+	where, args := f.where()
+	query := `SELECT ` + messageColumns + `, 0, e.vector FROM messages m
+		JOIN message_embeddings e ON e.message_id = m.id WHERE e.model = ?`
+	for _, cond := range where {
+		query += " AND " + cond
+	}
+	args = append([]any{model}, args...)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("query embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hit MessageHit
+		var blob []byte
+		if err := scanMessage(rows, &hit.ID, &hit.Message, &hit.Score, &blob); err != nil {
+			return err
+		}
+		if err := fn(hit, decodeVector(blob)); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (f MessageFilter) where() ([]string, []any) {
+	var where []string
+	var args []any
+	if f.GroupID != 0 {
+		where = append(where, "m.group_id = ?")
+		args = append(args, f.GroupID)
+	}
+	if f.SenderID != 0 {
+		where = append(where, "m.sender_id = ?")
+		args = append(args, f.SenderID)
+	}
+	if !f.From.IsZero() {
+		where = append(where, "m.timestamp >= ?")
+		args = append(args, f.From.UnixMilli())
+	}
+	if !f.To.IsZero() {
+		where = append(where, "m.timestamp < ?")
+		args = append(args, f.To.UnixMilli())
+	}
+	if f.Entity != "" {
+		where = append(where, `m.entities LIKE ? ESCAPE '\'`)
+		args = append(args, "% "+escapeLike(f.Entity)+" %")
+	}
+	return where, args
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanMessage scans messageColumns followed by extra columns
+func scanMessage(rows rowScanner, id *int64, msg *model.MessageData, extra ...any) error {
+	var ts int64
+	var reactions string
+	dest := []any{id, &msg.GroupID, &msg.GroupTitle, &msg.MsgID, &msg.ReplyToMsgID, &msg.SenderID, &msg.SenderName,
+		&msg.SenderUsername, &msg.SenderIsBot, &msg.SenderIsAdmin, &msg.Text, &ts, &msg.Account,
+		&msg.Source, &msg.Views, &msg.Forwards, &reactions, &msg.Replies, &msg.Late}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	msg.Timestamp = time.UnixMilli(ts)
+	if reactions != "" {
+		if err := json.Unmarshal([]byte(reactions), &msg.Reactions); err != nil {
+			return fmt.Errorf("decode reactions: %w", err)
+		}
+	}
+	return nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// encodeVector packs a vector as little-endian float32s
+func encodeVector(v []float32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(x))
+	}
+	return b
+}
+
+func decodeVector(b []byte) []float32 {
+	v := make([]float32, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return v
+}
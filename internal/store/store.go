@@ -0,0 +1,270 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// ErrNotFound is returned when a lookup matches nothing
+var ErrNotFound = errors.New("not found")
+
+// GlobalGroupID is the group ID under which global summaries are stored
+const GlobalGroupID int64 = 0
+
+// Store persists analysis output in a SQLite database
+type Store struct {
+	db *sql.DB
+}
+
+// migrations are applied in order, PRAGMA user_version records how many ran.
+// The first one only uses IF NOT EXISTS so databases created before
+// versioning pick it up again harmlessly.
+var migrations = [][]string{
+	{
+		`CREATE TABLE IF NOT EXISTS reports (
+			id            INTEGER PRIMARY KEY AUTOINCREMENT,
+			group_id      INTEGER NOT NULL,
+			content       TEXT    NOT NULL,
+			message_count INTEGER NOT NULL DEFAULT 0,
+			window_start  INTEGER NOT NULL,
+			window_end    INTEGER NOT NULL,
+			created_at    INTEGER NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS reports_group_created ON reports (group_id, created_at)`,
+		`CREATE TABLE IF NOT EXISTS llm_usage (
+			id                INTEGER PRIMARY KEY AUTOINCREMENT,
+			group_id          INTEGER NOT NULL,
+			stage             TEXT    NOT NULL,
+			model             TEXT    NOT NULL,
+			prompt_tokens     INTEGER NOT NULL,
+			completion_tokens INTEGER NOT NULL,
+			total_tokens      INTEGER NOT NULL,
+			cost              REAL    NOT NULL,
+			window_start      INTEGER NOT NULL,
+			window_end        INTEGER NOT NULL,
+			created_at        INTEGER NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS llm_usage_created ON llm_usage (created_at)`,
+	},
+	{
+		`ALTER TABLE reports ADD COLUMN provider TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE reports ADD COLUMN model TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE llm_usage ADD COLUMN provider TEXT NOT NULL DEFAULT ''`,
+	},
+	{
+		`CREATE TABLE messages (
+			id              INTEGER PRIMARY KEY AUTOINCREMENT,
+			group_id        INTEGER NOT NULL,
+			group_title     TEXT    NOT NULL DEFAULT '',
+			msg_id          INTEGER NOT NULL,
+			reply_to_msg_id INTEGER NOT NULL DEFAULT 0,
+			sender_id       INTEGER NOT NULL DEFAULT 0,
+			sender_name     TEXT    NOT NULL DEFAULT '',
+			sender_username TEXT    NOT NULL DEFAULT '',
+			sender_is_bot   INTEGER NOT NULL DEFAULT 0,
+			sender_is_admin INTEGER NOT NULL DEFAULT 0,
+			text            TEXT    NOT NULL,
+			timestamp       INTEGER NOT NULL
+		)`,
+		`CREATE INDEX messages_timestamp ON messages (timestamp)`,
+		`CREATE INDEX messages_group_timestamp ON messages (group_id, timestamp)`,
+	},
+	{
+		// Space separated tickers and contracts with leading and trailing spaces, for entity filters
+		`ALTER TABLE messages ADD COLUMN entities TEXT NOT NULL DEFAULT ''`,
+		// Trigram tokens also match inside CJK text, which has no word breaks
+		`CREATE VIRTUAL TABLE messages_fts USING fts5(text, content='messages', content_rowid='id', tokenize='trigram')`,
+		`CREATE TRIGGER messages_fts_insert AFTER INSERT ON messages BEGIN
+			INSERT INTO messages_fts (rowid, text) VALUES (new.id, new.text);
+		END`,
+		`CREATE TRIGGER messages_fts_delete AFTER DELETE ON messages BEGIN
+			INSERT INTO messages_fts (messages_fts, rowid, text) VALUES ('delete', old.id, old.text);
+		END`,
+		`INSERT INTO messages_fts (messages_fts) VALUES ('rebuild')`,
+		`CREATE TABLE message_embeddings (
+			message_id INTEGER PRIMARY KEY,
+			model      TEXT    NOT NULL,
+			vector     BLOB    NOT NULL
+		)`,
+	},
+	{
+		// Messages the embedding model rejected, retried with backoff up to a cap
+		`CREATE TABLE embedding_failures (
+			message_id INTEGER NOT NULL,
+			model      TEXT    NOT NULL,
+			attempts   INTEGER NOT NULL,
+			retry_at   INTEGER NOT NULL,
+			PRIMARY KEY (message_id, model)
+		)`,
+	},
+	{
+		// Telegram account the message arrived on
+		`ALTER TABLE messages ADD COLUMN account TEXT NOT NULL DEFAULT ''`,
+		// Kind of chat, and the reach of channel posts
+		`ALTER TABLE messages ADD COLUMN source TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE messages ADD COLUMN views INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE messages ADD COLUMN forwards INTEGER NOT NULL DEFAULT 0`,
+		// Reaction counts by emoji as JSON, updated when the window is analyzed
+		`ALTER TABLE messages ADD COLUMN reactions TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE messages ADD COLUMN replies INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE messages ADD COLUMN late INTEGER NOT NULL DEFAULT 0`,
+	},
+}
+
+// Open opens or creates the database at path and applies migrations
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("open store: %w", err)
+	}
+	// SQLite allows a single writer, serialize through one connection
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate store: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+
+	for ; version < len(migrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		for _, stmt := range migrations[version] {
+			if _, err := tx.Exec(stmt); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("version %d: %w", version+1, err)
+			}
+		}
+		// PRAGMA does not take bound parameters
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Report is a group report or a global summary
+type Report struct {
+	ID           int64     `json:"id"`
+	GroupID      int64     `json:"group_id"`
+	Content      string    `json:"content"`
+	Provider     string    `json:"provider"`
+	Model        string    `json:"model"`
+	MessageCount int       `json:"message_count"`
+	WindowStart  time.Time `json:"window_start"`
+	WindowEnd    time.Time `json:"window_end"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// SaveReport inserts r and sets its ID
+func (s *Store) SaveReport(ctx context.Context, r *Report) error {
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now()
+	}
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO reports (group_id, content, provider, model, message_count, window_start, window_end, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.GroupID, r.Content, r.Provider, r.Model, r.MessageCount,
+		r.WindowStart.UnixMilli(), r.WindowEnd.UnixMilli(), r.CreatedAt.UnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("save report: %w", err)
+	}
+	r.ID, err = res.LastInsertId()
+	return err
+}
+
+// ReportsBetween returns reports whose window ended between from and to,
+// newest first. A zero to has no upper bound and groupID 0 matches every
+// group, global summaries included.
+func (s *Store) ReportsBetween(ctx context.Context, groupID int64, from, to time.Time, limit int) ([]Report, error) {
+	query := `SELECT id, group_id, content, provider, model, message_count, window_start, window_end, created_at
+		FROM reports WHERE window_end >= ?`
+	args := []any{from.UnixMilli()}
+	if !to.IsZero() {
+		query += ` AND window_end <= ?`
+		args = append(args, to.UnixMilli())
+	}
+	if groupID != 0 {
+		query += ` AND group_id = ?`
+		args = append(args, groupID)
+	}
+	query += ` ORDER BY window_end DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query reports: %w", err)
+	}
+	return scanReports(rows)
+}
+
+// LatestReport returns the most recent report of a group
+func (s *Store) LatestReport(ctx context.Context, groupID int64) (*Report, error) {
+	reports, err := s.Reports(ctx, groupID, time.Time{}, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(reports) == 0 {
+		return nil, ErrNotFound
+	}
+	return &reports[0], nil
+}
+
+// Reports returns reports of a group newest first, created before the given
+// time if it is non-zero
+func (s *Store) Reports(ctx context.Context, groupID int64, before time.Time, limit int) ([]Report, error) {
+	if before.IsZero() {
+		before = time.Now().Add(time.Hour)
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, group_id, content, provider, model, message_count, window_start, window_end, created_at
+		 FROM reports WHERE group_id = ? AND created_at < ?
+		 ORDER BY created_at DESC LIMIT ?`,
+		groupID, before.UnixMilli(), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query reports: %w", err)
+	}
+	return scanReports(rows)
+}
+
+func scanReports(rows *sql.Rows) ([]Report, error) {
+	defer rows.Close()
+
+	var reports []Report
+	for rows.Next() {
+		var r Report
+		var start, end, created int64
+		if err := rows.Scan(&r.ID, &r.GroupID, &r.Content, &r.Provider, &r.Model, &r.MessageCount, &start, &end, &created); err != nil {
+			return nil, err
+		}
+		r.WindowStart = time.UnixMilli(start)
+		r.WindowEnd = time.UnixMilli(end)
+		r.CreatedAt = time.UnixMilli(created)
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
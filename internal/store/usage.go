@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Usage is the token usage and cost of one LLM call
+type Usage struct {
+	GroupID          int64
+	Stage            string
+	Provider         string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	Cost             float64
+	WindowStart      time.Time
+	WindowEnd        time.Time
+	CreatedAt        time.Time
+}
+
+// UsageTotals aggregates usage, Key is the model or group it is grouped by
+type UsageTotals struct {
+	Key              string  `json:"key,omitempty"`
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+func (s *Store) SaveUsage(ctx context.Context, u *Usage) error {
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now()
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO llm_usage (group_id, stage, provider, model, prompt_tokens, completion_tokens, total_tokens,
+		 cost, window_start, window_end, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		u.GroupID, u.Stage, u.Provider, u.Model, u.PromptTokens, u.CompletionTokens, u.TotalTokens,
+		u.Cost, u.WindowStart.UnixMilli(), u.WindowEnd.UnixMilli(), u.CreatedAt.UnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("save usage: %w", err)
+	}
+	return nil
+}
+
+// UsageSince totals all usage recorded at or after since
+func (s *Store) UsageSince(ctx context.Context, since time.Time) (UsageTotals, error) {
+	var t UsageTotals
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0),
+		 COALESCE(SUM(total_tokens), 0), COALESCE(SUM(cost), 0)
+		 FROM llm_usage WHERE created_at >= ?`,
+		since.UnixMilli(),
+	).Scan(&t.Calls, &t.PromptTokens, &t.CompletionTokens, &t.TotalTokens, &t.Cost)
+	if err != nil {
+		return t, fmt.Errorf("query usage: %w", err)
+	}
+	return t, nil
+}
+
+// UsageBy totals usage since the given time grouped by "model" or "group", most expensive first
+func (s *Store) UsageBy(ctx context.Context, column string, since time.Time, limit int) ([]UsageTotals, error) {
+	if column != "model" && column != "group" {
+		return nil, fmt.Errorf("unknown usage grouping: %s", column)
+	}
+	if column == "group" {
+		column = "CAST(group_id AS TEXT)"
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+column+`, COUNT(*), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens), SUM(cost)
+		 FROM llm_usage WHERE created_at >= ?
+		 GROUP BY 1 ORDER BY SUM(cost) DESC, SUM(total_tokens) DESC LIMIT ?`,
+		since.UnixMilli(), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query usage: %w", err)
+	}
+	defer rows.Close()
+
+	var totals []UsageTotals
+	for rows.Next() {
+		var t UsageTotals
+		if err := rows.Scan(&t.Key, &t.Calls, &t.PromptTokens, &t.CompletionTokens, &t.TotalTokens, &t.Cost); err != nil {
+			return nil, err
+		}
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
@@ -0,0 +1,150 @@
+package telegram
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// adminTTL is how long a group's admin list is trusted before refetching
+	adminTTL = time.Hour
+	// adminRetry is how long a failed fetch waits before it is tried again
+	adminRetry = time.Minute
+	// adminFetchTimeout bounds a background fetch of an admin list
+	adminFetchTimeout = 30 * time.Second
+)
+
+type adminEntry struct {
+	ids map[int64]struct{}
+	// When the list is fetched again
+	refresh  time.Time
+	fetching bool
+}
+
+// adminCache remembers the admins of each monitored group
+type adminCache struct {
+	groups map[int64]adminEntry
+	mu     sync.Mutex
+}
+
+func newAdminCache() *adminCache {
+	return &adminCache{groups: make(map[int64]adminEntry)}
+}
+
+// isAdmin reports whether userID administers the group the message was posted
+// in. It never waits for Telegram: the admin list is fetched in the background
+// when a group is first seen and after it expires, until then the last known
+// list is used, which for a new group is empty.
+func (a *adminCache) isAdmin(ctx context.Context, api *tg.Client, e tg.Entities, peer tg.PeerClass, userID int64) bool {
+	var groupID int64
+	switch p := peer.(type) {
+	case *tg.PeerChannel:
+		groupID = p.ChannelID
+	case *tg.PeerChat:
+		groupID = p.ChatID
+	default:
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry := a.groups[groupID]
+	if !entry.fetching && !time.Now().Before(entry.refresh) {
+		entry.fetching = true
+		a.groups[groupID] = entry
+		go a.fetch(context.WithoutCancel(ctx), api, groupID, inputPeer(e, peer))
+	}
+	_, admin := entry.ids[userID]
+	return admin
+}
+
+// fetch refreshes a group's admin list. A failure keeps the stale list and
+// is retried after adminRetry rather than a full TTL.
+func (a *adminCache) fetch(ctx context.Context, api *tg.Client, groupID int64, peer tg.InputPeerClass) {
+	ctx, cancel := context.WithTimeout(ctx, adminFetchTimeout)
+	defer cancel()
+	ids, err := fetchAdmins(ctx, api, peer)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry := a.groups[groupID]
+	entry.fetching = false
+	if err != nil {
+		log.Printf("Group %d: fetching admins failed: %v", groupID, err)
+		entry.refresh = time.Now().Add(adminRetry)
+	} else {
+		entry.ids, entry.refresh = ids, time.Now().Add(adminTTL)
+	}
+	a.groups[groupID] = entry
+}
+
+// inputPeer resolves the peer of a group with the access hash seen in e
+func inputPeer(e tg.Entities, peer tg.PeerClass) tg.InputPeerClass {
+	switch p := peer.(type) {
+	case *tg.PeerChannel:
+		var accessHash int64
+		if ch, ok := e.Channels[p.ChannelID]; ok {
+			accessHash = ch.AccessHash
+		}
+		return &tg.InputPeerChannel{ChannelID: p.ChannelID, AccessHash: accessHash}
+	case *tg.PeerChat:
+		return &tg.InputPeerChat{ChatID: p.ChatID}
+	}
+	return &tg.InputPeerEmpty{}
+}
+
+func fetchAdmins(ctx context.Context, api *tg.Client, peer tg.InputPeerClass) (map[int64]struct{}, error) {
+	ids := make(map[int64]struct{})
+
+	switch p := peer.(type) {
+	case *tg.InputPeerChannel:
+		res, err := api.ChannelsGetParticipants(ctx, &tg.ChannelsGetParticipantsRequest{
+			Channel: &tg.InputChannel{ChannelID: p.ChannelID, AccessHash: p.AccessHash},
+			Filter:  &tg.ChannelParticipantsAdmins{},
+			Limit:   200,
+		})
+		if err != nil {
+			return nil, err
+		}
+		participants, ok := res.(*tg.ChannelsChannelParticipants)
+		if !ok {
+			return ids, nil
+		}
+		for _, participant := range participants.Participants {
+			switch pt := participant.(type) {
+			case *tg.ChannelParticipantAdmin:
+				ids[pt.UserID] = struct{}{}
+			case *tg.ChannelParticipantCreator:
+				ids[pt.UserID] = struct{}{}
+			}
+		}
+
+	case *tg.InputPeerChat:
+		full, err := api.MessagesGetFullChat(ctx, p.ChatID)
+		if err != nil {
+			return nil, err
+		}
+		chatFull, ok := full.FullChat.(*tg.ChatFull)
+		if !ok {
+			return ids, nil
+		}
+		participants, ok := chatFull.Participants.(*tg.ChatParticipants)
+		if !ok {
+			return ids, nil
+		}
+		for _, participant := range participants.Participants {
+			switch pt := participant.(type) {
+			case *tg.ChatParticipantAdmin:
+				ids[pt.UserID] = struct{}{}
+			case *tg.ChatParticipantCreator:
+				ids[pt.UserID] = struct{}{}
+			}
+		}
+	}
+
+	return ids, nil
+}
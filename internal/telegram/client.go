@@ -1,22 +1,25 @@
 package telegram
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"log"
 	"net"
-	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/FuradWho/TgRadar-Go/internal/config"
 	"github.com/FuradWho/TgRadar-Go/internal/model"
+	"github.com/gotd/td/session"
 	"github.com/gotd/td/telegram"
-	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/telegram/auth/qrlogin"
 	"github.com/gotd/td/telegram/dcs"
+	"github.com/gotd/td/telegram/updates"
 	"github.com/gotd/td/tg"
 	"golang.org/x/net/proxy"
+	"golang.org/x/sync/errgroup"
 )
 
 // MessageHandler processes incoming messages
@@ -25,30 +28,99 @@ type MessageHandler func(model.MessageData)
 type Client struct {
 	client  *telegram.Client
 	cfg     *config.Config
+	account config.Account
 	handler MessageHandler
+	admins  *adminCache
+	// Groups messages are handled from, replaced once targets are resolved
+	groups atomic.Pointer[groupFilter]
+	// Update state shared by every restart of the client, loaded on first start
+	state *stateStore
+	// Session storage, kept across restarts so a derived key is reused
+	session session.Storage
+	// Asks for login codes and passwords when code_source is bot
+	asker Asker
+	// Called when the connection comes up or goes down
+	onState func(connected bool, err error)
+	// Called with reaction, view and forward updates
+	onEngagement func(model.Engagement)
+	// Access hashes of channels messages were seen from, for refreshes
+	accessHashes map[int64]int64
+	// Messages fetched by the gap recovery and not handled yet
+	recovered map[recoveredKey]time.Time
+	// Targets resolved on the first start, reused after reconnects
+	resolved *groupFilter
+	// Refreshes are refused until then after a FLOOD_WAIT
+	refreshPausedUntil time.Time
+	mu                 sync.Mutex
 }
 
-func NewClient(cfg *config.Config, handler MessageHandler) *Client {
-	return &Client{
-		cfg:     cfg,
-		handler: handler,
+func NewClient(cfg *config.Config, account config.Account, handler MessageHandler) *Client {
+	c := &Client{
+		cfg:          cfg,
+		account:      account,
+		handler:      handler,
+		admins:       newAdminCache(),
+		onState:      func(bool, error) {},
+		onEngagement: func(model.Engagement) {},
+		accessHashes: make(map[int64]int64),
+		recovered:    make(map[recoveredKey]time.Time),
 	}
+	c.groups.Store(idFilter(account))
+	return c
+}
+
+// OnState registers a callback for connection changes
+func (c *Client) OnState(fn func(connected bool, err error)) {
+	c.onState = fn
 }
 
 func (c *Client) Start(ctx context.Context) error {
+	if c.state == nil {
+		state, err := newStateStore(c.account.StateFile)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errConfig, err)
+		}
+		c.state = state
+	}
+	if c.session == nil {
+		storage, err := newSessionStorage(c.cfg, c.account.SessionFile)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errConfig, err)
+		}
+		c.session = storage
+	}
+
 	dispatcher := tg.NewUpdateDispatcher()
 	dispatcher.OnNewMessage(c.onNewMessage)
 	dispatcher.OnNewChannelMessage(c.onNewChannelMessage)
+	dispatcher.OnMessageReactions(c.onMessageReactions)
+	dispatcher.OnChannelMessageViews(c.onChannelMessageViews)
+	dispatcher.OnChannelMessageForwards(c.onChannelMessageForwards)
+	loggedIn := qrlogin.OnLoginToken(dispatcher)
+
+	// The updates manager tracks pts/qts/seq and fetches the difference
+	// after a gap or a reconnect, so missed messages are still delivered
+	gaps := updates.New(updates.Config{
+		Handler:      dispatcher,
+		Storage:      c.state,
+		AccessHasher: c.state,
+		OnChannelTooLong: func(channelID int64) {
+			log.Printf("[%s] Channel %d fell too far behind, messages in the gap are lost", c.account.Name, channelID)
+		},
+	})
 
 	opts := telegram.Options{
-		SessionStorage: &telegram.FileSessionStorage{Path: c.cfg.Telegram.SessionFile},
-		UpdateHandler:  dispatcher,
+		SessionStorage: c.session,
+		UpdateHandler:  gaps,
+		OnDead: func() {
+			c.onState(false, errConnectionDead)
+		},
 	}
 
-	if c.cfg.Telegram.Proxy != "" {
-		dialer, err := proxy.SOCKS5("tcp", c.cfg.Telegram.Proxy, nil, proxy.Direct)
+	if c.account.Proxy != "" {
+		dialer, err := proxy.SOCKS5("tcp", c.account.Proxy, nil, proxy.Direct)
 		if err != nil {
-			return fmt.Errorf("proxy config error: %w", err)
+			return fmt.Errorf("proxy config error: %w: %w", errConfig, err)
 		}
 		opts.Resolver = dcs.Plain(dcs.PlainOptions{
 			Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
@@ -58,121 +130,197 @@ func (c *Client) Start(ctx context.Context) error {
 				return dialer.Dial(network, addr)
 			},
 		})
-		log.Printf("Proxy enabled: %s", c.cfg.Telegram.Proxy)
+		log.Printf("[%s] Proxy enabled: %s", c.account.Name, c.account.Proxy)
 	}
 
+	// Refresh reads the client from other goroutines
+	c.mu.Lock()
 	c.client = telegram.NewClient(
 		c.cfg.Telegram.AppID,
 		c.cfg.Telegram.AppHash,
 		opts,
 	)
+	c.mu.Unlock()
 
 	return c.client.Run(ctx, func(ctx context.Context) error {
-		flow := auth.NewFlow(
-			termAuth{phone: c.cfg.Telegram.Phone, pw: c.cfg.Telegram.Password},
-			auth.SendCodeOptions{},
-		)
-
-		if err := c.client.Auth().IfNecessary(ctx, flow); err != nil {
+		if err := c.authorize(ctx, loggedIn); err != nil {
 			return err
 		}
 
-		me, _ := c.client.Self(ctx)
-		log.Printf("Logged in as: %s (%s), monitoring started...", me.FirstName, me.Username)
+		me, err := c.client.Self(ctx)
+		if err != nil {
+			return err
+		}
+		groups, err := c.resolveTargets(ctx)
+		if err != nil {
+			return err
+		}
+		c.groups.Store(groups)
+		log.Printf("[%s] Logged in as: %s (%s), monitoring started...", c.account.Name, me.FirstName, me.Username)
+		c.onState(true, nil)
 
-		<-ctx.Done()
-		return ctx.Err()
+		g, ctx := errgroup.WithContext(ctx)
+		g.Go(func() error {
+			// Messages in the differences it fetches are marked late
+			api := tg.NewClient(recoveryInvoker{next: c.client, c: c})
+			return gaps.Run(ctx, api, me.ID, updates.AuthOptions{
+				OnStart: func(context.Context) {
+					log.Printf("[%s] Update state loaded, catching up on missed messages", c.account.Name)
+				},
+			})
+		})
+		g.Go(func() error { return c.state.run(ctx) })
+		g.Go(func() error { return c.watch(ctx) })
+		return g.Wait()
 	})
 }
 
 func (c *Client) onNewMessage(ctx context.Context, e tg.Entities, update *tg.UpdateNewMessage) error {
 	msg, ok := update.Message.(*tg.Message)
-	if !ok || msg.Out {
+	if !ok || msg.Out && !msg.Post {
 		return nil
 	}
 
-	return c.handleMessage(msg)
+	return c.handleMessage(ctx, e, msg)
 }
 
 func (c *Client) onNewChannelMessage(ctx context.Context, e tg.Entities, update *tg.UpdateNewChannelMessage) error {
+	// Posts the account made in its own channels are kept, they are still news
 	msg, ok := update.Message.(*tg.Message)
-	if !ok || msg.Out {
+	if !ok || msg.Out && !msg.Post {
 		return nil
 	}
 
-	return c.handleMessage(msg)
+	return c.handleMessage(ctx, e, msg)
 }
 
-func (c *Client) handleMessage(msg *tg.Message) error {
-	var groupID int64
-	if peer, ok := msg.PeerID.(*tg.PeerChannel); ok {
-		groupID = peer.ChannelID
-	} else if peer, ok := msg.PeerID.(*tg.PeerChat); ok {
-		groupID = peer.ChatID
-	} else {
+func (c *Client) handleMessage(ctx context.Context, e tg.Entities, msg *tg.Message) error {
+	late := c.takeRecovered(msg)
+	source, groupID, ok := c.source(e, msg)
+	if !ok {
 		return nil
 	}
 
 	if c.cfg.Monitor.Debug {
-		log.Printf("[DEBUG] Received msg from group %d", groupID)
+		log.Printf("[DEBUG] Received msg from %s %d", source, groupID)
 	}
 
-	if len(c.cfg.Telegram.TargetGroups) > 0 {
-		found := false
-		for _, targetID := range c.cfg.Telegram.TargetGroups {
-			if targetID == groupID {
-				found = true
-				break
-			}
-		}
-		if !found {
-			return nil
-		}
+	// Direct messages are not limited by target groups
+	if source != model.SourceDM && !c.groups.Load().allows(groupID) {
+		return nil
 	}
 
 	if msg.Message == "" {
 		return nil
 	}
+	if _, ok := msg.PeerID.(*tg.PeerChannel); ok {
+		c.rememberChannel(e, groupID)
+	}
 
+	// Private chats and channel posts carry no sender, it is the chat itself
+	from := msg.FromID
+	if from == nil {
+		from = msg.PeerID
+	}
 	senderID := int64(0)
-	if fromUser, ok := msg.FromID.(*tg.PeerUser); ok {
-		senderID = fromUser.UserID
+	senderName, senderUsername := "", ""
+	isBot := false
+	isAdmin := false
+	isChannel := false
+	switch sender := from.(type) {
+	case *tg.PeerUser:
+		senderID = sender.UserID
+		if user, ok := e.Users[senderID]; ok {
+			isBot = user.Bot
+			senderName = strings.TrimSpace(user.FirstName + " " + user.LastName)
+			senderUsername = user.Username
+		}
+		// Admin lists cost an extra request per group, only fetch them when used
+		if c.cfg.Reputation.Enabled && source != model.SourceDM {
+			isAdmin = c.admins.isAdmin(ctx, c.client.API(), e, msg.PeerID, senderID)
+		}
+	case *tg.PeerChannel:
+		// Channel posts, and anonymous admins or channels posting in groups
+		senderID = sender.ChannelID
+		isChannel = true
+		if channel, ok := e.Channels[senderID]; ok {
+			senderName = channel.Title
+			senderUsername = channel.Username
+		}
+		if msg.PostAuthor != "" {
+			senderName = fmt.Sprintf("%s (%s)", senderName, msg.PostAuthor)
+		}
 	}
-	c.handler(model.MessageData{
-		GroupID:   groupID,
-		SenderID:  senderID,
-		Text:      msg.Message,
-		Timestamp: time.Unix(int64(msg.Date), 0),
-	})
-	return nil
-}
-
-type termAuth struct {
-	phone string
-	pw    string
-}
+	engagement := messageEngagement(msg)
 
-func (t termAuth) Phone(_ context.Context) (string, error) {
-	return t.phone, nil
-}
+	timestamp := time.Unix(int64(msg.Date), 0)
 
-func (t termAuth) Password(_ context.Context) (string, error) {
-	return t.pw, nil
-}
+	replyTo := 0
+	if header, ok := msg.ReplyTo.(*tg.MessageReplyHeader); ok {
+		replyTo = header.ReplyToMsgID
+	}
 
-func (t termAuth) AcceptTermsOfService(_ context.Context, tos tg.HelpTermsOfService) error {
+	c.handler(model.MessageData{
+		GroupID:         groupID,
+		GroupTitle:      groupTitle(e, msg.PeerID),
+		MsgID:           msg.ID,
+		ReplyToMsgID:    replyTo,
+		SenderID:        senderID,
+		SenderName:      senderName,
+		SenderUsername:  senderUsername,
+		SenderIsBot:     isBot,
+		SenderIsAdmin:   isAdmin,
+		SenderIsChannel: isChannel,
+		Text:            msg.Message,
+		Timestamp:       timestamp,
+		Late:            late,
+		Account:         c.account.Name,
+		Source:          source,
+		Views:           engagement.Views,
+		Forwards:        engagement.Forwards,
+		Reactions:       engagement.Reactions,
+		Replies:         engagement.Replies,
+	})
 	return nil
 }
 
-func (t termAuth) SignUp(_ context.Context) (auth.UserInfo, error) {
-	return auth.UserInfo{}, fmt.Errorf("sign up not supported")
+// source classifies the chat a message is from, reporting false when that
+// kind of chat is not read
+func (c *Client) source(e tg.Entities, msg *tg.Message) (string, int64, bool) {
+	sources := c.cfg.Telegram.Sources
+	switch peer := msg.PeerID.(type) {
+	case *tg.PeerChannel:
+		broadcast := msg.Post
+		if channel, ok := e.Channels[peer.ChannelID]; ok {
+			broadcast = channel.Broadcast
+		}
+		if broadcast {
+			return model.SourceChannel, peer.ChannelID, sources.Channels
+		}
+		return model.SourceSupergroup, peer.ChannelID, sources.Supergroups
+	case *tg.PeerChat:
+		return model.SourceGroup, peer.ChatID, sources.Groups
+	case *tg.PeerUser:
+		return model.SourceDM, model.DMChatID(peer.UserID), sources.DMs
+	}
+	return "", 0, false
 }
 
-func (t termAuth) Code(_ context.Context, sentCode *tg.AuthSentCode) (string, error) {
-	fmt.Print("Enter code: ")
-	code, err := bufio.NewReader(os.Stdin).ReadString('\n')
-	if err != nil {
-		return "", err
+// groupTitle looks up the chat title among the entities sent with the update
+func groupTitle(e tg.Entities, peer tg.PeerClass) string {
+	switch p := peer.(type) {
+	case *tg.PeerChannel:
+		if channel, ok := e.Channels[p.ChannelID]; ok {
+			return channel.Title
+		}
+	case *tg.PeerChat:
+		if chat, ok := e.Chats[p.ChatID]; ok {
+			return chat.Title
+		}
+	case *tg.PeerUser:
+		if user, ok := e.Users[p.UserID]; ok {
+			return strings.TrimSpace(user.FirstName + " " + user.LastName)
+		}
 	}
-	return strings.TrimSpace(code), nil
+	return ""
 }
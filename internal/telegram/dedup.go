@@ -0,0 +1,72 @@
+package telegram
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/metrics"
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+)
+
+// dedupTTL is how long a message is remembered. It covers the catch-up of
+// an account that was offline for up to a day while the others kept
+// running, the gap recovery delivering what it missed hours late.
+const dedupTTL = 24 * time.Hour
+
+// dedupSweep is how often expired messages are forgotten
+const dedupSweep = 10 * time.Minute
+
+// dedupKey identifies a message across accounts. Channels and supergroups
+// share message IDs between accounts, message IDs of other chats differ
+// per account, so sender, time and text are used instead.
+type dedupKey struct {
+	groupID  int64
+	msgID    int
+	senderID int64
+	unix     int64
+	text     uint64
+}
+
+func newDedupKey(msg model.MessageData) dedupKey {
+	if msg.Source == model.SourceChannel || msg.Source == model.SourceSupergroup {
+		return dedupKey{groupID: msg.GroupID, msgID: msg.MsgID}
+	}
+	h := fnv.New64a()
+	h.Write([]byte(msg.Text))
+	return dedupKey{groupID: msg.GroupID, senderID: msg.SenderID, unix: msg.Timestamp.Unix(), text: h.Sum64()}
+}
+
+// Dedup wraps handler so a message delivered by several accounts is only
+// handled once, as it arrived on the first one
+func Dedup(handler MessageHandler) MessageHandler {
+	seen := make(map[dedupKey]time.Time)
+	lastSweep := time.Now()
+	var mu sync.Mutex
+
+	return func(msg model.MessageData) {
+		key := newDedupKey(msg)
+
+		now := time.Now()
+		mu.Lock()
+		if now.Sub(lastSweep) > dedupSweep {
+			for k, at := range seen {
+				if now.Sub(at) > dedupTTL {
+					delete(seen, k)
+				}
+			}
+			lastSweep = now
+		}
+		_, dup := seen[key]
+		if !dup {
+			seen[key] = now
+		}
+		mu.Unlock()
+
+		if dup {
+			metrics.MessagesDuplicate.WithLabelValues(msg.Account).Inc()
+			return
+		}
+		handler(msg)
+	}
+}
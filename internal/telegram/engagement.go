@@ -0,0 +1,164 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// refreshBatch is the most messages fetched per request
+const refreshBatch = 100
+
+// OnEngagement registers a callback for reaction, view and forward updates
+// of messages already handled
+func (c *Client) OnEngagement(fn func(model.Engagement)) {
+	c.onEngagement = fn
+}
+
+func (c *Client) onMessageReactions(_ context.Context, _ tg.Entities, update *tg.UpdateMessageReactions) error {
+	groupID, ok := peerID(update.Peer)
+	if !ok {
+		return nil
+	}
+	c.onEngagement(model.Engagement{
+		Account:   c.account.Name,
+		GroupID:   groupID,
+		MsgID:     update.MsgID,
+		Reactions: reactionCounts(update.Reactions),
+	})
+	return nil
+}
+
+func (c *Client) onChannelMessageViews(_ context.Context, _ tg.Entities, update *tg.UpdateChannelMessageViews) error {
+	c.onEngagement(model.Engagement{Account: c.account.Name, GroupID: update.ChannelID, MsgID: update.ID, Views: update.Views})
+	return nil
+}
+
+func (c *Client) onChannelMessageForwards(_ context.Context, _ tg.Entities, update *tg.UpdateChannelMessageForwards) error {
+	c.onEngagement(model.Engagement{Account: c.account.Name, GroupID: update.ChannelID, MsgID: update.ID, Forwards: update.Forwards})
+	return nil
+}
+
+// Refresh fetches the current engagement of messages in a group. After a
+// FLOOD_WAIT the account refuses refreshes until the wait is over.
+func (c *Client) Refresh(ctx context.Context, groupID int64, source string, msgIDs []int) ([]model.Engagement, error) {
+	c.mu.Lock()
+	client := c.client
+	hash, hashOK := c.accessHashes[groupID]
+	pausedUntil := c.refreshPausedUntil
+	c.mu.Unlock()
+	if client == nil {
+		return nil, errors.New("client not started")
+	}
+	if time.Now().Before(pausedUntil) {
+		return nil, fmt.Errorf("refresh paused by FLOOD_WAIT until %s", pausedUntil.Format(time.TimeOnly))
+	}
+	api := client.API()
+
+	var channel *tg.InputChannel
+	if source == model.SourceChannel || source == model.SourceSupergroup {
+		if !hashOK {
+			return nil, fmt.Errorf("no access hash for channel %d", groupID)
+		}
+		channel = &tg.InputChannel{ChannelID: groupID, AccessHash: hash}
+	}
+
+	var engagement []model.Engagement
+	for start := 0; start < len(msgIDs); start += refreshBatch {
+		ids := make([]tg.InputMessageClass, 0, refreshBatch)
+		for _, id := range msgIDs[start:min(start+refreshBatch, len(msgIDs))] {
+			ids = append(ids, &tg.InputMessageID{ID: id})
+		}
+
+		var res tg.MessagesMessagesClass
+		var err error
+		if channel != nil {
+			res, err = api.ChannelsGetMessages(ctx, &tg.ChannelsGetMessagesRequest{Channel: channel, ID: ids})
+		} else {
+			res, err = api.MessagesGetMessages(ctx, ids)
+		}
+		if err != nil {
+			if wait, ok := tgerr.AsFloodWait(err); ok {
+				c.mu.Lock()
+				c.refreshPausedUntil = time.Now().Add(wait)
+				c.mu.Unlock()
+			}
+			return engagement, err
+		}
+		modified, ok := res.AsModified()
+		if !ok {
+			continue
+		}
+		for _, m := range modified.GetMessages() {
+			msg, ok := m.(*tg.Message)
+			if !ok {
+				continue
+			}
+			e := messageEngagement(msg)
+			e.Account, e.GroupID = c.account.Name, groupID
+			engagement = append(engagement, e)
+		}
+	}
+	return engagement, nil
+}
+
+// messageEngagement reads the counters a message carries
+func messageEngagement(msg *tg.Message) model.Engagement {
+	e := model.Engagement{MsgID: msg.ID}
+	e.Views, _ = msg.GetViews()
+	e.Forwards, _ = msg.GetForwards()
+	if replies, ok := msg.GetReplies(); ok {
+		e.Replies = replies.Replies
+	}
+	if reactions, ok := msg.GetReactions(); ok {
+		e.Reactions = reactionCounts(reactions)
+	}
+	return e
+}
+
+// reactionCounts counts reactions by emoji, custom emoji and paid stars
+// are each counted under one symbol
+func reactionCounts(reactions tg.MessageReactions) map[string]int {
+	counts := make(map[string]int, len(reactions.Results))
+	for _, r := range reactions.Results {
+		switch reaction := r.Reaction.(type) {
+		case *tg.ReactionEmoji:
+			counts[reaction.Emoticon] += r.Count
+		case *tg.ReactionCustomEmoji:
+			counts["✨"] += r.Count
+		case *tg.ReactionPaid:
+			counts["⭐"] += r.Count
+		}
+	}
+	return counts
+}
+
+// rememberChannel keeps the access hash of a channel for later requests
+func (c *Client) rememberChannel(e tg.Entities, channelID int64) {
+	channel, ok := e.Channels[channelID]
+	if !ok || channel.Min {
+		return
+	}
+	c.mu.Lock()
+	c.accessHashes[channelID] = channel.AccessHash
+	c.mu.Unlock()
+}
+
+// peerID returns the chat ID of a peer as messages are keyed by, see
+// model.DMChatID for private chats
+func peerID(peer tg.PeerClass) (int64, bool) {
+	switch p := peer.(type) {
+	case *tg.PeerChannel:
+		return p.ChannelID, true
+	case *tg.PeerChat:
+		return p.ChatID, true
+	case *tg.PeerUser:
+		return model.DMChatID(p.UserID), true
+	}
+	return 0, false
+}
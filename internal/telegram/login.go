@@ -0,0 +1,264 @@
+package telegram
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/telegram/auth/qrlogin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"golang.org/x/term"
+	"rsc.io/qr"
+)
+
+// codeFilePollInterval is how often the code file and variable are checked
+// for a code
+const codeFilePollInterval = 2 * time.Second
+
+// errLogin marks a login that cannot complete without operator action
+var errLogin = errors.New("login failed")
+
+// loginMu lets one account log in at a time, as they share the code sources
+var loginMu sync.Mutex
+
+// Asker asks a user a question and returns the reply, used to get login
+// codes and passwords through the notifier bot
+type Asker interface {
+	Ask(ctx context.Context, question string, users []int64) (string, error)
+}
+
+// AskVia sets where login codes are asked for when code_source is bot
+func (c *Client) AskVia(asker Asker) {
+	c.asker = asker
+}
+
+// authorize logs in unless the session is already authorized
+func (c *Client) authorize(ctx context.Context, loggedIn qrlogin.LoggedIn) error {
+	status, err := c.client.Auth().Status(ctx)
+	if err != nil {
+		return err
+	}
+	if status.Authorized {
+		return nil
+	}
+
+	loginMu.Lock()
+	defer loginMu.Unlock()
+	log.Printf("[%s] Logging in", c.account.Name)
+	if c.cfg.Telegram.Login.Method == config.LoginQR {
+		return c.loginQR(ctx, loggedIn)
+	}
+	flow := auth.NewFlow(authenticator{c: c}, auth.SendCodeOptions{})
+	return c.client.Auth().IfNecessary(ctx, flow)
+}
+
+// loginQR shows login tokens as QR codes until one is scanned from a
+// logged in Telegram app, then enters the 2FA password if one is set
+func (c *Client) loginQR(ctx context.Context, loggedIn qrlogin.LoggedIn) error {
+	_, err := c.client.QR().Auth(ctx, loggedIn, c.showQR)
+	if !tgerr.Is(err, "SESSION_PASSWORD_NEEDED") {
+		return err
+	}
+
+	password, err := c.password(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = c.client.Auth().Password(ctx, password)
+	return err
+}
+
+// showQR prints the token as a QR code and saves it as a PNG when configured
+func (c *Client) showQR(_ context.Context, token qrlogin.Token) error {
+	code, err := qr.Encode(token.URL(), qr.L)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(renderQR(code))
+	log.Printf("Scan the QR code in Telegram under Settings > Devices > Link Desktop Device, it expires at %s",
+		token.Expires().Local().Format(time.TimeOnly))
+
+	if path := c.cfg.Telegram.Login.QRFile; path != "" {
+		if err := os.WriteFile(path, code.PNG(), 0o600); err != nil {
+			return fmt.Errorf("write QR code: %w", err)
+		}
+		log.Printf("QR code saved to %s", path)
+	}
+	return nil
+}
+
+// renderQR draws a QR code with half blocks, two modules per character row
+func renderQR(code *qr.Code) string {
+	const quiet = 2
+	var b strings.Builder
+	for y := -quiet; y < code.Size+quiet; y += 2 {
+		for x := -quiet; x < code.Size+quiet; x++ {
+			top, bottom := code.Black(x, y), code.Black(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteRune(' ')
+			case top:
+				b.WriteRune('▄')
+			case bottom:
+				b.WriteRune('▀')
+			default:
+				b.WriteRune('█')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// authenticator answers the phone code flow from the configured sources
+type authenticator struct {
+	c *Client
+}
+
+func (a authenticator) Phone(_ context.Context) (string, error) {
+	if a.c.account.Phone == "" {
+		return "", fmt.Errorf("%w: account %s needs a phone for code login", errLogin, a.c.account.Name)
+	}
+	return a.c.account.Phone, nil
+}
+
+func (a authenticator) Password(ctx context.Context) (string, error) {
+	return a.c.password(ctx)
+}
+
+func (a authenticator) AcceptTermsOfService(_ context.Context, tos tg.HelpTermsOfService) error {
+	return nil
+}
+
+func (a authenticator) SignUp(_ context.Context) (auth.UserInfo, error) {
+	return auth.UserInfo{}, fmt.Errorf("%w: %s has no Telegram account, sign up in an official Telegram app first",
+		errLogin, a.c.account.Phone)
+}
+
+func (a authenticator) Code(ctx context.Context, _ *tg.AuthSentCode) (string, error) {
+	code, err := a.c.prompt(ctx, "login code", true)
+	if err != nil {
+		return "", err
+	}
+	// Codes sent through bots are spaced out so Telegram does not revoke them
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, code), nil
+}
+
+// password returns the configured 2FA password or prompts for it
+func (c *Client) password(ctx context.Context) (string, error) {
+	if c.account.Password != "" {
+		return c.account.Password, nil
+	}
+	return c.prompt(ctx, "2FA password", false)
+}
+
+// prompt reads a login secret from the configured source. A login code only
+// exists once it was sent, so the env source waits for it in the code
+// variable or the code file.
+func (c *Client) prompt(ctx context.Context, what string, isCode bool) (string, error) {
+	login := c.cfg.Telegram.Login
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(login.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	var value string
+	var err error
+	switch login.CodeSource {
+	case config.CodeSourceEnv:
+		if isCode {
+			value, err = waitForEnv(ctx, what, login.CodeEnv, login.CodeFile)
+			break
+		}
+		value = os.Getenv(login.PasswordEnv)
+		if value == "" {
+			err = fmt.Errorf("%s is not set", login.PasswordEnv)
+		}
+	case config.CodeSourceFile:
+		value, err = waitForFile(ctx, what, login.CodeFile)
+	case config.CodeSourceBot:
+		if c.asker == nil {
+			err = errors.New("the notifier bot is not configured")
+			break
+		}
+		question := fmt.Sprintf("🔐 TgRadar needs the Telegram %s for account %s (%s). Reply to this message with it, it will be deleted.",
+			what, c.account.Name, c.account.Phone)
+		if isCode {
+			question += " Put spaces between the digits (1 2 3 4 5), Telegram revokes codes sent verbatim."
+		}
+		value, err = c.asker.Ask(ctx, question, login.BotUsers)
+	default:
+		value, err = readStdin(fmt.Sprintf("%s for account %s", what, c.account.Name), !isCode)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: reading %s: %w", errLogin, what, err)
+	}
+	return strings.TrimSpace(value), nil
+}
+
+// readStdin prompts on the terminal, without echo for secrets
+func readStdin(what string, secret bool) (string, error) {
+	fmt.Printf("Enter %s: ", what)
+	fd := int(os.Stdin.Fd())
+	if secret && term.IsTerminal(fd) {
+		value, err := term.ReadPassword(fd)
+		fmt.Println()
+		return string(value), err
+	}
+	return bufio.NewReader(os.Stdin).ReadString('\n')
+}
+
+// waitForFile waits for a non-empty file and removes it once read, so a
+// stale code is never reused
+func waitForFile(ctx context.Context, what, path string) (string, error) {
+	log.Printf("Waiting for the %s to be written to %s", what, path)
+	return waitForCode(ctx, "", path)
+}
+
+// waitForEnv waits for a code in the variable env or the file at path. The
+// variable is cleared once read, so a rejected code is not tried again.
+func waitForEnv(ctx context.Context, what, env, path string) (string, error) {
+	log.Printf("Waiting for the %s in $%s or %s", what, env, path)
+	return waitForCode(ctx, env, path)
+}
+
+func waitForCode(ctx context.Context, env, path string) (string, error) {
+	ticker := time.NewTicker(codeFilePollInterval)
+	defer ticker.Stop()
+	for {
+		if value := os.Getenv(env); env != "" && strings.TrimSpace(value) != "" {
+			os.Unsetenv(env)
+			return value, nil
+		}
+		data, err := os.ReadFile(path)
+		if err == nil && strings.TrimSpace(string(data)) != "" {
+			if err := os.Remove(path); err != nil {
+				log.Printf("Removing %s failed: %v", path, err)
+			}
+			return string(data), nil
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
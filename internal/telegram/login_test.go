@@ -0,0 +1,47 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testCodeEnv = "TGRADAR_TEST_LOGIN_CODE"
+
+func TestWaitForEnvReadsVariable(t *testing.T) {
+	t.Setenv(testCodeEnv, "12345")
+	code, err := waitForEnv(context.Background(), "login code", testCodeEnv, filepath.Join(t.TempDir(), "code.txt"))
+	if err != nil || code != "12345" {
+		t.Fatalf("waitForEnv = %q, %v, want 12345", code, err)
+	}
+	if _, ok := os.LookupEnv(testCodeEnv); ok {
+		t.Error("code variable is still set after it was read")
+	}
+}
+
+func TestWaitForEnvFallsBackToFile(t *testing.T) {
+	t.Setenv(testCodeEnv, "")
+	path := filepath.Join(t.TempDir(), "code.txt")
+	if err := os.WriteFile(path, []byte("67890\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	code, err := waitForEnv(context.Background(), "login code", testCodeEnv, path)
+	if err != nil || code != "67890\n" {
+		t.Fatalf("waitForEnv = %q, %v, want the file contents", code, err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Error("code file is kept after it was read")
+	}
+}
+
+func TestWaitForEnvTimesOut(t *testing.T) {
+	t.Setenv(testCodeEnv, "")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := waitForEnv(ctx, "login code", testCodeEnv, filepath.Join(t.TempDir(), "code.txt")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("waitForEnv without a code = %v, want the deadline", err)
+	}
+}
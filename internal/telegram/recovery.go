@@ -0,0 +1,86 @@
+package telegram
+
+import (
+	"context"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+// recoveredTTL is how long a fetched message waits to be handled before it
+// is forgotten, the updates manager handles it right after the fetch
+const recoveredTTL = 10 * time.Minute
+
+// recoveredKey identifies a message fetched by the gap recovery
+type recoveredKey struct {
+	groupID int64
+	msgID   int
+}
+
+// recoveryInvoker notes the messages returned by getDifference and
+// getChannelDifference, which the updates manager fetches after a gap or a
+// reconnect, so they are marked late when handled
+type recoveryInvoker struct {
+	next tg.Invoker
+	c    *Client
+}
+
+func (r recoveryInvoker) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	if err := r.next.Invoke(ctx, input, output); err != nil {
+		return err
+	}
+
+	var msgs []tg.MessageClass
+	switch out := output.(type) {
+	case *tg.UpdatesDifferenceBox:
+		switch diff := out.Difference.(type) {
+		case *tg.UpdatesDifference:
+			msgs = diff.NewMessages
+		case *tg.UpdatesDifferenceSlice:
+			msgs = diff.NewMessages
+		}
+	case *tg.UpdatesChannelDifferenceBox:
+		if diff, ok := out.ChannelDifference.(*tg.UpdatesChannelDifference); ok {
+			msgs = diff.NewMessages
+		}
+	}
+	if len(msgs) > 0 {
+		r.c.markRecovered(msgs)
+	}
+	return nil
+}
+
+func (c *Client) markRecovered(msgs []tg.MessageClass) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, at := range c.recovered {
+		if now.Sub(at) > recoveredTTL {
+			delete(c.recovered, key)
+		}
+	}
+	for _, m := range msgs {
+		msg, ok := m.(*tg.Message)
+		if !ok {
+			continue
+		}
+		if groupID, ok := peerID(msg.PeerID); ok {
+			c.recovered[recoveredKey{groupID: groupID, msgID: msg.ID}] = now
+		}
+	}
+}
+
+// takeRecovered reports whether msg was fetched by the gap recovery
+func (c *Client) takeRecovered(msg *tg.Message) bool {
+	groupID, ok := peerID(msg.PeerID)
+	if !ok {
+		return false
+	}
+	key := recoveredKey{groupID: groupID, msgID: msg.ID}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, recovered := c.recovered[key]
+	delete(c.recovered, key)
+	return recovered
+}
@@ -0,0 +1,268 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/gotd/td/session"
+	"github.com/gotd/td/telegram"
+)
+
+const (
+	// sessionVersion is the layout version of encrypted session files
+	sessionVersion = 1
+	sessionKeySize = 32
+	// PBKDF2-SHA256 parameters for passphrase derived keys
+	sessionSaltSize   = 16
+	sessionIterations = 600_000
+)
+
+var (
+	errSessionKey     = errors.New("wrong session key")
+	errSessionCorrupt = errors.New("session file is corrupted")
+)
+
+// encryptedSession is the layout of an encrypted session file
+type encryptedSession struct {
+	Version int `json:"version"`
+	// Salt and iterations of a passphrase derived key, empty otherwise
+	Salt       []byte `json:"salt,omitempty"`
+	Iterations int    `json:"iterations,omitempty"`
+	// Identifies the key so a wrong key is told apart from a damaged file
+	KeyID []byte `json:"key_id"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+// sessionStorage keeps the session encrypted with AES-GCM. A plaintext
+// session found at the path is encrypted in place on first load.
+type sessionStorage struct {
+	path string
+	// The key itself, or the passphrase it is derived from
+	secret []byte
+	derive bool
+	// Key, salt and iterations in use, derived once as PBKDF2 is slow on
+	// purpose. Iterations start at the count used for new files.
+	key        []byte
+	salt       []byte
+	iterations int
+	mu         sync.Mutex
+}
+
+// newSessionStorage returns the session storage at path for the configured
+// key source, plain file storage when none is set
+func newSessionStorage(cfg *config.Config, path string) (session.Storage, error) {
+	key := cfg.Telegram.SessionKey
+	s := &sessionStorage{path: path, iterations: sessionIterations}
+	switch key.Source {
+	case "":
+		return &telegram.FileSessionStorage{Path: path}, nil
+	case config.KeySourcePassphrase:
+		passphrase := os.Getenv(key.PassphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("session passphrase: %s is not set", key.PassphraseEnv)
+		}
+		s.secret, s.derive = []byte(passphrase), true
+	case config.KeySourceEnv:
+		value := os.Getenv(key.KeyEnv)
+		if value == "" {
+			return nil, fmt.Errorf("session key: %s is not set", key.KeyEnv)
+		}
+		raw, err := decodeSessionKey(value)
+		if err != nil {
+			return nil, fmt.Errorf("session key in %s: %w", key.KeyEnv, err)
+		}
+		s.secret = raw
+	case config.KeySourceFile:
+		data, err := os.ReadFile(key.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read session key file: %w", err)
+		}
+		raw, err := decodeSessionKey(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("session key in %s: %w", key.KeyFile, err)
+		}
+		s.secret = raw
+	}
+	return s, nil
+}
+
+// decodeSessionKey decodes a base64 key, as made by `openssl rand -base64 32`
+func decodeSessionKey(value string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("not base64: %w", err)
+	}
+	if len(raw) != sessionKeySize {
+		return nil, fmt.Errorf("want %d bytes, got %d", sessionKeySize, len(raw))
+	}
+	return raw, nil
+}
+
+func (s *sessionStorage) LoadSession(_ context.Context) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, session.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read session file: %w", err)
+	}
+
+	// Encrypted files are told apart from gotd's plaintext JSON by the nonce
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", errSessionCorrupt, s.path, err)
+	}
+	if _, ok := fields["nonce"]; !ok {
+		if !isPlainSession(data) {
+			return nil, fmt.Errorf("%w: %s is neither encrypted nor a session", errSessionCorrupt, s.path)
+		}
+		if err := s.store(data); err != nil {
+			return nil, fmt.Errorf("encrypt plaintext session: %w", err)
+		}
+		log.Printf("Plaintext session in %s encrypted", s.path)
+		return data, nil
+	}
+
+	var file encryptedSession
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", errSessionCorrupt, s.path, err)
+	}
+	if file.Version != sessionVersion {
+		return nil, fmt.Errorf("%w: %s has unknown version %d", errSessionCorrupt, s.path, file.Version)
+	}
+	if s.derive && (len(file.Salt) == 0 || file.Iterations <= 0) {
+		return nil, fmt.Errorf("%w: %s was not encrypted with a passphrase", errSessionKey, s.path)
+	}
+	if err := s.useKey(file.Salt, file.Iterations); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(file.KeyID, keyID(s.key)) {
+		return nil, fmt.Errorf("%w: %s was encrypted with another key", errSessionKey, s.path)
+	}
+
+	aead, err := newAEAD(s.key)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("%w: %s has a bad nonce", errSessionCorrupt, s.path)
+	}
+	plain, err := aead.Open(nil, file.Nonce, file.Data, sessionAAD())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s failed authentication", errSessionCorrupt, s.path)
+	}
+	return plain, nil
+}
+
+func (s *sessionStorage) StoreSession(_ context.Context, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store(data)
+}
+
+// store encrypts data and replaces the session file atomically
+func (s *sessionStorage) store(data []byte) error {
+	if s.key == nil {
+		var salt []byte
+		if s.derive {
+			salt = make([]byte, sessionSaltSize)
+			rand.Read(salt)
+		}
+		if err := s.useKey(salt, s.iterations); err != nil {
+			return err
+		}
+	}
+
+	aead, err := newAEAD(s.key)
+	if err != nil {
+		return err
+	}
+	file := encryptedSession{
+		Version: sessionVersion,
+		KeyID:   keyID(s.key),
+		Nonce:   make([]byte, aead.NonceSize()),
+	}
+	if s.derive {
+		file.Salt, file.Iterations = s.salt, s.iterations
+	}
+	rand.Read(file.Nonce)
+	file.Data = aead.Seal(nil, file.Nonce, data, sessionAAD())
+
+	out, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, out, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// useKey sets the key, deriving it from the passphrase with salt and
+// iterations unless it was already derived with the same ones
+func (s *sessionStorage) useKey(salt []byte, iterations int) error {
+	if !s.derive {
+		s.key = s.secret
+		return nil
+	}
+	if s.key != nil && bytes.Equal(s.salt, salt) && s.iterations == iterations {
+		return nil
+	}
+	key, err := pbkdf2.Key(sha256.New, string(s.secret), salt, iterations, sessionKeySize)
+	if err != nil {
+		return fmt.Errorf("derive session key: %w", err)
+	}
+	s.key, s.salt, s.iterations = key, salt, iterations
+	return nil
+}
+
+// isPlainSession reports whether data is a session as gotd's file storage
+// writes it, the only plaintext that is migrated
+func isPlainSession(data []byte) bool {
+	var plain struct {
+		Version int
+		Data    session.Data
+	}
+	if err := json.Unmarshal(data, &plain); err != nil {
+		return false
+	}
+	return plain.Version == 1 && len(plain.Data.AuthKey) > 0
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// keyID is a short hash of the key, it reveals nothing useful about it
+func keyID(key []byte) []byte {
+	sum := sha256.Sum256(append([]byte("tgradar session key\x00"), key...))
+	return sum[:8]
+}
+
+// sessionAAD binds the ciphertext to the file layout version
+func sessionAAD() []byte {
+	return fmt.Appendf(nil, "tgradar-session-v%d", sessionVersion)
+}
@@ -0,0 +1,203 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gotd/td/session"
+)
+
+// testIterations keeps key derivation fast in tests
+const testIterations = 1000
+
+func newTestStorage(t *testing.T, path string, secret string, derive bool) *sessionStorage {
+	t.Helper()
+	s := &sessionStorage{path: path, secret: []byte(secret), derive: derive, iterations: testIterations}
+	if !derive {
+		s.secret = bytes.Repeat([]byte(secret), sessionKeySize)[:sessionKeySize]
+	}
+	return s
+}
+
+func plainSession(t *testing.T) []byte {
+	t.Helper()
+	data, err := json.Marshal(struct {
+		Version int
+		Data    session.Data
+	}{Version: 1, Data: session.Data{DC: 2, Addr: "149.154.167.50:443", AuthKey: bytes.Repeat([]byte{7}, 256)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// editFile rewrites the encrypted session file at path through edit
+func editFile(t *testing.T, path string, edit func(*encryptedSession)) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file encryptedSession
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	edit(&file)
+	if data, err = json.Marshal(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionStorageErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		derive bool
+		// Applied to the file after a session was stored with "secret"
+		tamper func(t *testing.T, path string)
+		// Secret the session is then loaded with
+		secret string
+		want   error
+	}{
+		{
+			name:   "tampered ciphertext",
+			derive: true,
+			tamper: func(t *testing.T, path string) {
+				editFile(t, path, func(f *encryptedSession) { f.Data[0] ^= 1 })
+			},
+			secret: "secret",
+			want:   errSessionCorrupt,
+		},
+		{
+			name:   "tampered nonce",
+			derive: true,
+			tamper: func(t *testing.T, path string) {
+				editFile(t, path, func(f *encryptedSession) { f.Nonce[0] ^= 1 })
+			},
+			secret: "secret",
+			want:   errSessionCorrupt,
+		},
+		{
+			name: "short nonce",
+			tamper: func(t *testing.T, path string) {
+				editFile(t, path, func(f *encryptedSession) { f.Nonce = f.Nonce[:4] })
+			},
+			secret: "secret",
+			want:   errSessionCorrupt,
+		},
+		{
+			name: "truncated file",
+			tamper: func(t *testing.T, path string) {
+				data, _ := os.ReadFile(path)
+				os.WriteFile(path, data[:len(data)/2], 0o600)
+			},
+			secret: "secret",
+			want:   errSessionCorrupt,
+		},
+		{
+			name: "json without nonce that is not a session",
+			tamper: func(t *testing.T, path string) {
+				os.WriteFile(path, []byte(`{"version":1,"key_id":"AAAA","data":"AAAA"}`), 0o600)
+			},
+			secret: "secret",
+			want:   errSessionCorrupt,
+		},
+		{
+			name:   "wrong passphrase",
+			derive: true,
+			secret: "other",
+			want:   errSessionKey,
+		},
+		{
+			name:   "wrong key",
+			secret: "other",
+			want:   errSessionKey,
+		},
+		{
+			name: "passphrase for a key encrypted file",
+			tamper: func(t *testing.T, path string) {
+				editFile(t, path, func(f *encryptedSession) { f.Salt, f.Iterations = nil, 0 })
+			},
+			derive: true,
+			secret: "secret",
+			want:   errSessionKey,
+		},
+	}
+
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "session.json")
+			if err := newTestStorage(t, path, "secret", tt.derive).StoreSession(ctx, plainSession(t)); err != nil {
+				t.Fatal(err)
+			}
+			if tt.tamper != nil {
+				tt.tamper(t, path)
+			}
+
+			data, err := newTestStorage(t, path, tt.secret, tt.derive).LoadSession(ctx)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("LoadSession() = %q, %v, want %v", data, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionStorageMigratesPlaintext(t *testing.T) {
+	ctx := context.Background()
+	for _, derive := range []bool{true, false} {
+		path := filepath.Join(t.TempDir(), "session.json")
+		plain := plainSession(t)
+		if err := os.WriteFile(path, plain, 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := newTestStorage(t, path, "secret", derive).LoadSession(ctx)
+		if err != nil || !bytes.Equal(data, plain) {
+			t.Fatalf("derive %v: first load = %q, %v, want the plaintext session", derive, data, err)
+		}
+		onDisk, _ := os.ReadFile(path)
+		if bytes.Contains(onDisk, []byte("AuthKey")) {
+			t.Fatalf("derive %v: session file still holds plaintext", derive)
+		}
+
+		// A new storage reads the migrated file back
+		data, err = newTestStorage(t, path, "secret", derive).LoadSession(ctx)
+		if err != nil || !bytes.Equal(data, plain) {
+			t.Fatalf("derive %v: reload = %q, %v, want the plaintext session", derive, data, err)
+		}
+	}
+}
+
+func TestSessionStorageKeepsIterations(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "session.json")
+	if err := newTestStorage(t, path, "secret", true).StoreSession(ctx, plainSession(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A file written with other iterations keeps them when stored again
+	s := newTestStorage(t, path, "secret", true)
+	s.iterations = sessionIterations
+	if _, err := s.LoadSession(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StoreSession(ctx, plainSession(t)); err != nil {
+		t.Fatal(err)
+	}
+	editFile(t, path, func(f *encryptedSession) {
+		if f.Iterations != testIterations {
+			t.Fatalf("stored iterations = %d, want %d", f.Iterations, testIterations)
+		}
+	})
+	if _, err := newTestStorage(t, path, "secret", true).LoadSession(ctx); err != nil {
+		t.Fatalf("reload after store: %v", err)
+	}
+}
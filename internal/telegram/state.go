@@ -0,0 +1,234 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram/updates"
+)
+
+// stateFlushInterval is how often changed update state is written to disk
+const stateFlushInterval = 2 * time.Second
+
+// errStateNotFound is returned when setting fields of a user without state
+var errStateNotFound = errors.New("update state not found")
+
+// userState is the persisted update state of one account
+type userState struct {
+	State      updates.State `json:"state"`
+	ChannelPts map[int64]int `json:"channel_pts"`
+}
+
+// stateFile is the layout of the state file. Access hashes are kept apart
+// as they are learned before the account's update state exists.
+type stateFile struct {
+	Users        map[int64]*userState      `json:"users"`
+	AccessHashes map[int64]map[int64]int64 `json:"access_hashes"`
+}
+
+// stateStore persists pts/qts/seq and per-channel pts and access hashes so
+// the updates manager can fetch what was missed while disconnected. Changes
+// are kept in memory and flushed to a JSON file periodically.
+type stateStore struct {
+	path   string
+	users  map[int64]*userState
+	hashes map[int64]map[int64]int64
+	dirty  bool
+	mu     sync.Mutex
+}
+
+func newStateStore(path string) (*stateStore, error) {
+	s := &stateStore{
+		path:   path,
+		users:  make(map[int64]*userState),
+		hashes: make(map[int64]map[int64]int64),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read update state file: %w", err)
+	}
+	var file stateFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse update state file: %w", err)
+	}
+	for id, u := range file.Users {
+		if u.ChannelPts == nil {
+			u.ChannelPts = make(map[int64]int)
+		}
+		s.users[id] = u
+	}
+	for id, hashes := range file.AccessHashes {
+		s.hashes[id] = hashes
+	}
+	return s, nil
+}
+
+// run flushes changes until ctx is cancelled, then flushes once more
+func (s *stateStore) run(ctx context.Context) error {
+	ticker := time.NewTicker(stateFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.flush(); err != nil {
+				log.Printf("Update state save failed: %v", err)
+			}
+		case <-ctx.Done():
+			if err := s.flush(); err != nil {
+				log.Printf("Update state save failed: %v", err)
+			}
+			return nil
+		}
+	}
+}
+
+func (s *stateStore) flush() error {
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(stateFile{Users: s.users, AccessHashes: s.hashes})
+	s.dirty = false
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// user returns the state of userID, creating it when create is set
+func (s *stateStore) user(userID int64, create bool) *userState {
+	u, ok := s.users[userID]
+	if !ok && create {
+		u = &userState{ChannelPts: make(map[int64]int)}
+		s.users[userID] = u
+	}
+	return u
+}
+
+// update applies fn to an existing user state
+func (s *stateStore) update(userID int64, fn func(u *userState)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.user(userID, false)
+	if u == nil {
+		return errStateNotFound
+	}
+	fn(u)
+	s.dirty = true
+	return nil
+}
+
+func (s *stateStore) GetState(_ context.Context, userID int64) (updates.State, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.user(userID, false)
+	if u == nil {
+		return updates.State{}, false, nil
+	}
+	return u.State, true, nil
+}
+
+func (s *stateStore) SetState(_ context.Context, userID int64, state updates.State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// A new common state invalidates the channel states it was fetched with
+	u := s.user(userID, true)
+	u.State = state
+	u.ChannelPts = make(map[int64]int)
+	s.dirty = true
+	return nil
+}
+
+func (s *stateStore) SetPts(_ context.Context, userID int64, pts int) error {
+	return s.update(userID, func(u *userState) { u.State.Pts = pts })
+}
+
+func (s *stateStore) SetQts(_ context.Context, userID int64, qts int) error {
+	return s.update(userID, func(u *userState) { u.State.Qts = qts })
+}
+
+func (s *stateStore) SetDate(_ context.Context, userID int64, date int) error {
+	return s.update(userID, func(u *userState) { u.State.Date = date })
+}
+
+func (s *stateStore) SetSeq(_ context.Context, userID int64, seq int) error {
+	return s.update(userID, func(u *userState) { u.State.Seq = seq })
+}
+
+func (s *stateStore) SetDateSeq(_ context.Context, userID int64, date, seq int) error {
+	return s.update(userID, func(u *userState) {
+		u.State.Date = date
+		u.State.Seq = seq
+	})
+}
+
+func (s *stateStore) GetChannelPts(_ context.Context, userID, channelID int64) (int, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.user(userID, false)
+	if u == nil {
+		return 0, false, nil
+	}
+	pts, ok := u.ChannelPts[channelID]
+	return pts, ok, nil
+}
+
+func (s *stateStore) SetChannelPts(_ context.Context, userID, channelID int64, pts int) error {
+	return s.update(userID, func(u *userState) { u.ChannelPts[channelID] = pts })
+}
+
+func (s *stateStore) ForEachChannels(ctx context.Context, userID int64, f func(ctx context.Context, channelID int64, pts int) error) error {
+	s.mu.Lock()
+	var channels map[int64]int
+	if u := s.user(userID, false); u != nil {
+		channels = make(map[int64]int, len(u.ChannelPts))
+		for id, pts := range u.ChannelPts {
+			channels[id] = pts
+		}
+	}
+	s.mu.Unlock()
+
+	for id, pts := range channels {
+		if err := f(ctx, id, pts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *stateStore) SetChannelAccessHash(_ context.Context, userID, channelID, accessHash int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hashes, ok := s.hashes[userID]
+	if !ok {
+		hashes = make(map[int64]int64)
+		s.hashes[userID] = hashes
+	}
+	hashes[channelID] = accessHash
+	s.dirty = true
+	return nil
+}
+
+func (s *stateStore) GetChannelAccessHash(_ context.Context, userID, channelID int64) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hash, ok := s.hashes[userID][channelID]
+	return hash, ok, nil
+}
@@ -0,0 +1,310 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/FuradWho/TgRadar-Go/internal/metrics"
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+	"github.com/FuradWho/TgRadar-Go/internal/notifier"
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/tgerr"
+)
+
+// Connection states reported by the supervisor
+const (
+	StateConnecting   = "connecting"
+	StateConnected    = "connected"
+	StateDisconnected = "disconnected"
+	StateFailed       = "failed"
+	StateStopped      = "stopped"
+)
+
+// pingInterval is how often a live connection is health checked
+const pingInterval = 30 * time.Second
+
+var (
+	// errConfig marks errors a restart cannot fix
+	errConfig = errors.New("invalid configuration")
+	// errConnectionDead is reported when gotd gives up on a connection
+	errConnectionDead = errors.New("connection dead")
+)
+
+// fatalErrors are RPC errors meaning the session or account can no longer be used
+var fatalErrors = []string{
+	"AUTH_KEY_UNREGISTERED",
+	"AUTH_KEY_INVALID",
+	"AUTH_KEY_DUPLICATED",
+	"SESSION_REVOKED",
+	"SESSION_EXPIRED",
+	"USER_DEACTIVATED",
+	"USER_DEACTIVATED_BAN",
+	"PHONE_NUMBER_BANNED",
+	"PHONE_NUMBER_INVALID",
+	"PHONE_CODE_INVALID",
+	"PHONE_CODE_EXPIRED",
+	"PASSWORD_HASH_INVALID",
+	"API_ID_INVALID",
+}
+
+// IsFatal reports whether err needs operator action rather than a reconnect
+func IsFatal(err error) bool {
+	return errors.Is(err, errConfig) || errors.Is(err, errLogin) ||
+		errors.Is(err, errSessionKey) || errors.Is(err, errSessionCorrupt) ||
+		auth.IsUnauthorized(err) || tgerr.Is(err, fatalErrors...)
+}
+
+// ConnectionStatus describes the Telegram connection of an account
+type ConnectionStatus struct {
+	Account string    `json:"account"`
+	State   string    `json:"state"`
+	Since   time.Time `json:"since"`
+	// Restarts of the client since the process started
+	Restarts  int    `json:"restarts"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Supervisor keeps the Telegram client running, restarting it with
+// exponential backoff after transient failures
+type Supervisor struct {
+	cfg      *config.Config
+	client   *Client
+	notifier notifier.Sender
+	status   ConnectionStatus
+	// Whether the current disconnection was reported to the bot chat
+	alerted bool
+	mu      sync.Mutex
+}
+
+func NewSupervisor(cfg *config.Config, client *Client, notifier notifier.Sender) *Supervisor {
+	s := &Supervisor{
+		cfg:      cfg,
+		client:   client,
+		notifier: notifier,
+		status:   ConnectionStatus{Account: client.account.Name, State: StateConnecting, Since: time.Now()},
+	}
+	client.OnState(func(connected bool, err error) {
+		if connected {
+			s.setState(StateConnected, nil)
+		} else {
+			s.setState(StateDisconnected, err)
+		}
+	})
+	return s
+}
+
+// Run starts the client and restarts it until ctx is cancelled or a fatal
+// error occurs, which is returned
+func (s *Supervisor) Run(ctx context.Context) error {
+	rc := s.cfg.Telegram.Reconnect
+	minBackoff := time.Duration(rc.MinBackoffSeconds) * time.Second
+	maxBackoff := time.Duration(rc.MaxBackoffSeconds) * time.Second
+	backoff := minBackoff
+
+	go s.watchAlerts(ctx)
+
+	for {
+		started := time.Now()
+		err := s.client.Start(ctx)
+		if ctx.Err() != nil {
+			s.setState(StateStopped, nil)
+			return nil
+		}
+		if err == nil {
+			err = errors.New("client stopped unexpectedly")
+		}
+		if IsFatal(err) {
+			s.setState(StateFailed, err)
+			s.notify(ctx, fmt.Sprintf("❌ Telegram client stopped, manual action needed: %v", err))
+			return err
+		}
+		s.setState(StateDisconnected, err)
+
+		// A connection that held up for a while starts the backoff over
+		if time.Since(started) > maxBackoff {
+			backoff = minBackoff
+		}
+		delay := backoff/2 + rand.N(backoff/2+1)
+		log.Printf("[%s] Telegram client failed: %v, restarting in %v", s.client.account.Name, err, delay.Round(time.Millisecond))
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			s.setState(StateStopped, nil)
+			return nil
+		}
+		backoff = min(backoff*2, maxBackoff)
+		metrics.TelegramRestarts.WithLabelValues(s.client.account.Name).Inc()
+
+		s.mu.Lock()
+		s.status.Restarts++
+		s.mu.Unlock()
+		s.setState(StateConnecting, nil)
+	}
+}
+
+// Status returns the current connection state
+func (s *Supervisor) Status() ConnectionStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Supervisors runs the clients of several accounts side by side
+type Supervisors []*Supervisor
+
+// Run runs every supervisor until ctx is cancelled or all of them stopped.
+// An account failing for good leaves the others running, its error is
+// returned once all have stopped.
+func (ss Supervisors) Run(ctx context.Context) error {
+	errs := make([]error, len(ss))
+	var wg sync.WaitGroup
+	for i, s := range ss {
+		wg.Go(func() {
+			if err := s.Run(ctx); err != nil {
+				errs[i] = fmt.Errorf("account %s: %w", s.client.account.Name, err)
+			}
+		})
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Refresh fetches the current engagement of messages through the account
+// that received them, message IDs of basic groups being per account
+func (ss Supervisors) Refresh(ctx context.Context, account string, groupID int64, source string, msgIDs []int) ([]model.Engagement, error) {
+	for _, s := range ss {
+		if s.client.account.Name == account {
+			return s.client.Refresh(ctx, groupID, source, msgIDs)
+		}
+	}
+	return nil, fmt.Errorf("unknown account %q", account)
+}
+
+// Status returns the connection state of every account
+func (ss Supervisors) Status() []ConnectionStatus {
+	statuses := make([]ConnectionStatus, 0, len(ss))
+	for _, s := range ss {
+		statuses = append(statuses, s.Status())
+	}
+	return statuses
+}
+
+// setState records a state change, keeping the start of an outage while it
+// moves between disconnected and connecting
+func (s *Supervisor) setState(state string, err error) {
+	s.mu.Lock()
+	prev := s.status
+	if err != nil {
+		s.status.LastError = err.Error()
+	}
+	if state == prev.State {
+		s.mu.Unlock()
+		return
+	}
+	down := prev.State == StateDisconnected || prev.State == StateConnecting
+	if !(down && (state == StateDisconnected || state == StateConnecting)) {
+		s.status.Since = time.Now()
+	}
+	s.status.State = state
+	alerted := s.alerted
+	if state == StateConnected {
+		s.alerted = false
+	}
+	s.mu.Unlock()
+
+	if state == StateConnected {
+		metrics.TelegramConnected.WithLabelValues(prev.Account).Set(1)
+		if alerted {
+			s.notify(context.Background(), fmt.Sprintf("✅ Telegram reconnected after %v", time.Since(prev.Since).Round(time.Second)))
+		}
+	} else {
+		metrics.TelegramConnected.WithLabelValues(prev.Account).Set(0)
+	}
+}
+
+// watchAlerts reports a disconnection to the bot chat once it has lasted alert_after_seconds
+func (s *Supervisor) watchAlerts(ctx context.Context) {
+	alertAfter := time.Duration(s.cfg.Telegram.Reconnect.AlertAfterSeconds) * time.Second
+	if alertAfter <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(min(alertAfter, pingInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		s.mu.Lock()
+		status := s.status
+		due := !s.alerted && status.State != StateConnected && status.State != StateFailed &&
+			status.State != StateStopped && time.Since(status.Since) >= alertAfter
+		if due {
+			s.alerted = true
+		}
+		s.mu.Unlock()
+
+		if due {
+			s.notify(ctx, fmt.Sprintf("⚠️ Telegram disconnected for %v, still retrying. Last error: %s",
+				time.Since(status.Since).Round(time.Second), status.LastError))
+		}
+	}
+}
+
+func (s *Supervisor) notify(ctx context.Context, text string) {
+	if len(s.cfg.Telegram.Accounts) > 1 {
+		text = fmt.Sprintf("[%s] %s", s.client.account.Name, text)
+	}
+	log.Print(text)
+	if s.notifier == nil {
+		return
+	}
+	if err := s.notifier.Send(ctx, text); err != nil {
+		log.Printf("Notifier send failed: %v", err)
+	}
+}
+
+// watch health checks the connection until ctx is cancelled, failing once
+// pings have not succeeded for dead_after_seconds so the client is restarted
+func (c *Client) watch(ctx context.Context) error {
+	deadAfter := time.Duration(c.cfg.Telegram.Reconnect.DeadAfterSeconds) * time.Second
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	lastOK := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		err := c.client.Ping(pingCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			// Also marks the recovery after gotd reconnected on its own
+			lastOK = time.Now()
+			c.onState(true, nil)
+			continue
+		}
+
+		c.onState(false, err)
+		if deadAfter > 0 && time.Since(lastOK) >= deadAfter {
+			return fmt.Errorf("no successful ping for %v: %w", time.Since(lastOK).Round(time.Second), err)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/gotd/td/telegram/query"
+	"github.com/gotd/td/telegram/query/dialogs"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// targetError is a target that cannot be resolved, as opposed to a failed request
+type targetError string
+
+func (e targetError) Error() string { return string(e) }
+
+// groupFilter decides which groups messages are handled from
+type groupFilter struct {
+	// nil handles every group that is not excluded
+	include map[int64]bool
+	exclude map[int64]bool
+}
+
+func (f *groupFilter) allows(groupID int64) bool {
+	if f.exclude[groupID] {
+		return false
+	}
+	return f.include == nil || f.include[groupID]
+}
+
+// idFilter builds a filter from the targets given by ID, used until the
+// others are resolved after login
+func idFilter(account config.Account) *groupFilter {
+	f := &groupFilter{exclude: make(map[int64]bool)}
+	if len(account.TargetGroups) > 0 {
+		f.include = make(map[int64]bool)
+	}
+	for _, target := range account.TargetGroups {
+		if id, ok := config.ParseGroupID(target); ok {
+			f.include[id] = true
+		}
+	}
+	for _, target := range account.ExcludeGroups {
+		if id, ok := config.ParseGroupID(target); ok {
+			f.exclude[id] = true
+		}
+	}
+	return f
+}
+
+// resolveTargets resolves every target and exclusion to group IDs, once per
+// process as reconnects reuse the result. Targets that cannot be resolved
+// are logged and skipped, network failures are returned and so is a target
+// list of which nothing resolved.
+func (c *Client) resolveTargets(ctx context.Context) (*groupFilter, error) {
+	c.mu.Lock()
+	resolved := c.resolved
+	c.mu.Unlock()
+	if resolved != nil {
+		return resolved, nil
+	}
+
+	r := &targetResolver{api: c.client.API(), account: c.account.Name}
+	f := &groupFilter{}
+	var err error
+	if len(c.account.TargetGroups) > 0 {
+		if f.include, err = r.resolve(ctx, c.account.TargetGroups); err != nil {
+			return nil, err
+		}
+		if len(f.include) == 0 {
+			return nil, fmt.Errorf("%w: account %s: no target group could be resolved", errConfig, c.account.Name)
+		}
+	}
+	if f.exclude, err = r.resolve(ctx, c.account.ExcludeGroups); err != nil {
+		return nil, err
+	}
+	if len(c.account.TargetGroups) > 0 || len(c.account.ExcludeGroups) > 0 {
+		log.Printf("[%s] Target groups resolved: %d included, %d excluded", c.account.Name, len(f.include), len(f.exclude))
+	}
+
+	c.mu.Lock()
+	c.resolved = f
+	c.mu.Unlock()
+	return f, nil
+}
+
+// dialogTitle is a group or channel the account is a member of
+type dialogTitle struct {
+	id    int64
+	title string
+}
+
+type targetResolver struct {
+	api     *tg.Client
+	account string
+	// Dialogs of the account, fetched for the first title pattern
+	dialogs []dialogTitle
+}
+
+func (r *targetResolver) resolve(ctx context.Context, targets []string) (map[int64]bool, error) {
+	ids := make(map[int64]bool)
+	for _, target := range targets {
+		found, err := r.resolveOne(ctx, target)
+		if err == nil && len(found) == 0 {
+			err = targetError("no group matches")
+		}
+		// Failed requests and flood waits are returned so the next restart retries
+		var te targetError
+		_, rpc := tgerr.As(err)
+		if _, flood := tgerr.AsFloodWait(err); err != nil && (flood || !rpc && !errors.As(err, &te)) {
+			return nil, fmt.Errorf("resolve target %s: %w", target, err)
+		}
+		if err != nil {
+			log.Printf("[%s] Warning: target %s could not be resolved: %v", r.account, target, err)
+			continue
+		}
+		for _, id := range found {
+			ids[id] = true
+		}
+	}
+	return ids, nil
+}
+
+// resolveOne resolves a target to the groups it names, see config.ParseGroupID
+func (r *targetResolver) resolveOne(ctx context.Context, target string) ([]int64, error) {
+	target = strings.TrimSpace(target)
+	if id, ok := config.ParseGroupID(target); ok {
+		return []int64{id}, nil
+	}
+	if pattern, ok := config.TitlePattern(target); ok {
+		return r.matchTitles(ctx, regexp.MustCompile(pattern))
+	}
+	if username, ok := strings.CutPrefix(target, "@"); ok {
+		return r.resolveUsername(ctx, username)
+	}
+
+	path, ok := trimLink(target)
+	if !ok {
+		return nil, targetError("not an ID, @username, t.me link or /title pattern/")
+	}
+	if hash, ok := strings.CutPrefix(path, "+"); ok {
+		return r.resolveInvite(ctx, hash)
+	}
+	if hash, ok := strings.CutPrefix(path, "joinchat/"); ok {
+		return r.resolveInvite(ctx, hash)
+	}
+	// Private message links: t.me/c/<channel id>/<message id>
+	if rest, ok := strings.CutPrefix(path, "c/"); ok {
+		id, _, _ := strings.Cut(rest, "/")
+		if id, ok := config.ParseGroupID(id); ok {
+			return []int64{id}, nil
+		}
+		return nil, targetError("bad private link")
+	}
+	username, _, _ := strings.Cut(path, "/")
+	return r.resolveUsername(ctx, username)
+}
+
+// trimLink returns the path of a t.me link without scheme, host and query
+func trimLink(target string) (string, bool) {
+	link := strings.TrimPrefix(strings.TrimPrefix(target, "https://"), "http://")
+	for _, host := range []string{"t.me/", "telegram.me/", "telegram.dog/"} {
+		if path, ok := strings.CutPrefix(link, host); ok {
+			path, _, _ = strings.Cut(path, "?")
+			path = strings.Trim(path, "/")
+			return path, path != ""
+		}
+	}
+	return "", false
+}
+
+func (r *targetResolver) resolveUsername(ctx context.Context, username string) ([]int64, error) {
+	resolved, err := r.api.ContactsResolveUsername(ctx, &tg.ContactsResolveUsernameRequest{Username: username})
+	if err != nil {
+		return nil, err
+	}
+	switch p := resolved.Peer.(type) {
+	case *tg.PeerChannel:
+		return []int64{p.ChannelID}, nil
+	case *tg.PeerChat:
+		return []int64{p.ChatID}, nil
+	default:
+		return nil, targetError("@" + username + " is a user, not a group")
+	}
+}
+
+// resolveInvite resolves an invite link of a group the account is in
+func (r *targetResolver) resolveInvite(ctx context.Context, hash string) ([]int64, error) {
+	invite, err := r.api.MessagesCheckChatInvite(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if already, ok := invite.(*tg.ChatInviteAlready); ok {
+		return []int64{already.Chat.GetID()}, nil
+	}
+	return nil, targetError("the account is not a member, join the group first")
+}
+
+// matchTitles returns the groups whose title matches pattern
+func (r *targetResolver) matchTitles(ctx context.Context, pattern *regexp.Regexp) ([]int64, error) {
+	if r.dialogs == nil {
+		r.dialogs = []dialogTitle{}
+		err := query.GetDialogs(r.api).BatchSize(100).ForEach(ctx, func(_ context.Context, elem dialogs.Elem) error {
+			switch p := elem.Dialog.GetPeer().(type) {
+			case *tg.PeerChannel:
+				if channel, ok := elem.Entities.Channel(p.ChannelID); ok {
+					r.dialogs = append(r.dialogs, dialogTitle{id: p.ChannelID, title: channel.Title})
+				}
+			case *tg.PeerChat:
+				if chat, ok := elem.Entities.Chat(p.ChatID); ok {
+					r.dialogs = append(r.dialogs, dialogTitle{id: p.ChatID, title: chat.Title})
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			r.dialogs = nil
+			return nil, err
+		}
+	}
+
+	var ids []int64
+	for _, d := range r.dialogs {
+		if pattern.MatchString(d.title) {
+			ids = append(ids, d.id)
+		}
+	}
+	return ids, nil
+}
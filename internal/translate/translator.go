@@ -0,0 +1,138 @@
+package translate
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/FuradWho/TgRadar-Go/internal/ai"
+	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/FuradWho/TgRadar-Go/internal/model"
+	"github.com/FuradWho/TgRadar-Go/internal/preprocess"
+)
+
+// languageNames spells out language codes for the translation prompt
+var languageNames = map[string]string{
+	preprocess.LangChinese:    "简体中文",
+	preprocess.LangEnglish:    "英文",
+	preprocess.LangRussian:    "俄文",
+	preprocess.LangVietnamese: "越南文",
+	preprocess.LangJapanese:   "日文",
+	preprocess.LangKorean:     "韩文",
+}
+
+// Translator translates messages into the analysis language in batches,
+// caching translations so repeated texts are only sent once
+type Translator struct {
+	aiClient  *ai.Client
+	language  string
+	batchSize int
+	cacheSize int
+	cache     map[string]string
+	// Insertion order of cache keys, oldest first
+	order []string
+	mu    sync.Mutex
+}
+
+func NewTranslator(cfg *config.Config, aiClient *ai.Client) *Translator {
+	return &Translator{
+		aiClient:  aiClient,
+		language:  cfg.Translate.Language,
+		batchSize: cfg.Translate.BatchSize,
+		cacheSize: cfg.Translate.CacheSize,
+		cache:     make(map[string]string),
+	}
+}
+
+// Language returns the analysis language code
+func (t *Translator) Language() string {
+	return t.language
+}
+
+// Translate fills in Translation for messages not in the analysis language.
+// Messages whose batch fails are left untranslated. It returns the results
+// of the requests made so their usage can be recorded.
+func (t *Translator) Translate(ctx context.Context, msgs []model.MessageData) []ai.Result {
+	// Distinct texts that need a request, with the messages waiting on each
+	pending := make(map[string][]int)
+	var texts []string
+	for i := range msgs {
+		if !t.needsTranslation(msgs[i]) {
+			continue
+		}
+		text := strings.TrimSpace(msgs[i].Text)
+		if translation, ok := t.cached(text); ok {
+			msgs[i].Translation = translation
+			continue
+		}
+		if _, ok := pending[text]; !ok {
+			texts = append(texts, text)
+		}
+		pending[text] = append(pending[text], i)
+	}
+
+	var results []ai.Result
+	for start := 0; start < len(texts); start += t.batchSize {
+		batch := texts[start:min(start+t.batchSize, len(texts))]
+		translations, result, err := t.aiClient.Translate(ctx, t.languageName(), batch)
+		if result.Model != "" {
+			results = append(results, result)
+		}
+		if err != nil {
+			log.Printf("Translation of %d messages failed: %v", len(batch), err)
+			continue
+		}
+		for j, text := range batch {
+			translation := strings.TrimSpace(translations[j])
+			if translation == "" {
+				continue
+			}
+			t.store(text, translation)
+			for _, i := range pending[text] {
+				msgs[i].Translation = translation
+			}
+		}
+	}
+	return results
+}
+
+func (t *Translator) needsTranslation(msg model.MessageData) bool {
+	lang := msg.Lang
+	if lang == "" {
+		lang = preprocess.DetectLanguage(msg.Text)
+	}
+	return lang != t.language && lang != preprocess.LangUnknown && msg.Translation == ""
+}
+
+func (t *Translator) languageName() string {
+	if name, ok := languageNames[t.language]; ok {
+		return name
+	}
+	return t.language
+}
+
+func (t *Translator) cached(text string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	translation, ok := t.cache[text]
+	return translation, ok
+}
+
+// store caches a translation, evicting the oldest entries beyond the cache size
+func (t *Translator) store(text, translation string) {
+	if t.cacheSize <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.cache[text]; !ok {
+		t.order = append(t.order, text)
+	}
+	t.cache[text] = translation
+	for len(t.order) > t.cacheSize {
+		delete(t.cache, t.order[0])
+		t.order = t.order[1:]
+	}
+}
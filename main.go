@@ -2,15 +2,23 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
-	"time"
+	"sync"
+	"syscall"
 
 	"github.com/FuradWho/TgRadar-Go/internal/ai"
 	"github.com/FuradWho/TgRadar-Go/internal/analyzer"
+	"github.com/FuradWho/TgRadar-Go/internal/api"
 	"github.com/FuradWho/TgRadar-Go/internal/config"
+	"github.com/FuradWho/TgRadar-Go/internal/cost"
+	"github.com/FuradWho/TgRadar-Go/internal/export"
+	"github.com/FuradWho/TgRadar-Go/internal/model"
 	"github.com/FuradWho/TgRadar-Go/internal/notifier"
+	"github.com/FuradWho/TgRadar-Go/internal/search"
+	"github.com/FuradWho/TgRadar-Go/internal/store"
 	"github.com/FuradWho/TgRadar-Go/internal/telegram"
 )
 
@@ -21,40 +29,171 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// Subcommands, no argument runs the monitor
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "reputation":
+			runReputation(cfg, os.Args[2:])
+		case "calls":
+			runCalls(cfg, os.Args[2:])
+		case "replay":
+			runReplay(cfg, os.Args[2:])
+		case "export":
+			runExport(cfg, os.Args[2:])
+		case "search":
+			runSearch(cfg, os.Args[2:])
+		default:
+			log.Fatalf("Unknown command: %s", os.Args[1])
+		}
+		return
+	}
+
+	if err := run(cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run monitors until shutdown, it returns errors rather than exiting so the
+// deferred closes run
+func run(cfg *config.Config) error {
+	var err error
+
 	// 2. Initialize AI client
 	aiClient := ai.NewClient(cfg)
 
 	// 2.5 Initialize notifier (optional)
 	var sender notifier.Sender
+	var bot *notifier.TelegramBot
 	if cfg.Telegram.BotToken != "" && cfg.Telegram.BotChatID != 0 {
-		sender = notifier.NewTelegramBot(cfg.Telegram.BotToken, cfg.Telegram.BotChatID)
+		bot = notifier.NewTelegramBot(cfg.Telegram.BotToken, cfg.Telegram.BotChatID)
+		sender = bot
+	}
+
+	// 2.6 Open report storage (optional), LLM cost is tracked in it
+	var db *store.Store
+	var costs *cost.Tracker
+	if cfg.Storage.Path != "" {
+		db, err = store.Open(cfg.Storage.Path)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		costs = cost.NewTracker(cfg, db)
 	}
 
 	// 3. Initialize Analyzer
-	anal := analyzer.NewManager(cfg, aiClient, sender)
+	anal, err := analyzer.NewManager(cfg, aiClient, sender, db, costs)
+	if err != nil {
+		return err
+	}
+
+	// 3.5 Search over archived messages (optional)
+	var searcher *search.Searcher
+	if db != nil && cfg.Storage.Messages {
+		searcher = search.NewSearcher(cfg, db, aiClient, costs)
+	}
 
 	// 4. Initialize Telegram client
-	// Bind message handler to analyzer's AddMessage
-	tgClient := telegram.NewClient(cfg, anal.AddMessage)
+	// Bind message handler to analyzer's AddMessage, also exporting live (optional)
+	handler := anal.AddMessage
+	var exporter *export.Exporter
+	if cfg.Export.Live {
+		exporter, err = export.NewExporter(cfg)
+		if err != nil {
+			return err
+		}
+		handler = func(msg model.MessageData) {
+			exporter.Add(msg)
+			anal.AddMessage(msg)
+		}
+	}
+	// Every account feeds the same analyzer, messages several of them see are handled once
+	if len(cfg.Telegram.Accounts) > 1 {
+		handler = telegram.Dedup(handler)
+	}
+	var supervisors telegram.Supervisors
+	for _, account := range cfg.Telegram.Accounts {
+		tgClient := telegram.NewClient(cfg, account, handler)
+		tgClient.OnEngagement(anal.UpdateEngagement)
+		if bot != nil {
+			tgClient.AskVia(bot)
+		}
+		supervisors = append(supervisors, telegram.NewSupervisor(cfg, tgClient, sender))
+	}
+	anal.RefreshVia(supervisors)
 
-	// 5. Start service
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	// 5. Start service, SIGTERM is how containers are stopped
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	// Start analysis loop (background)
-	go anal.Start(ctx)
+	// Start analysis loop (background), both flush their buffers on shutdown
+	var wg sync.WaitGroup
+	wg.Go(func() { anal.Start(ctx) })
+	if exporter != nil {
+		wg.Go(func() { exporter.Run(ctx) })
+	}
+	if searcher != nil {
+		go searcher.Run(ctx)
+	}
+
+	// Answer bot commands (optional)
+	if bot != nil {
+		handlers := map[string]notifier.CommandHandler{
+			"cost": func(ctx context.Context, _ string) (string, error) {
+				return anal.CostReport(ctx)
+			},
+		}
+		if searcher != nil {
+			handlers["search"] = func(ctx context.Context, args string) (string, error) {
+				q, err := search.ParseQuery(args)
+				if err != nil {
+					return "", err
+				}
+				hits, err := searcher.Search(ctx, q)
+				if err != nil {
+					return "", err
+				}
+				return search.FormatHits(hits), nil
+			}
+			handlers["ask"] = func(ctx context.Context, args string) (string, error) {
+				q, err := search.ParseQuery(args)
+				if err != nil {
+					return "", err
+				}
+				answer, err := searcher.Ask(ctx, q.Text, q.MessageFilter)
+				if err != nil {
+					return "", err
+				}
+				return search.FormatAnswer(answer), nil
+			}
+		}
+		go bot.Listen(ctx, handlers)
+	}
+
+	// Start HTTP API (optional)
+	if cfg.API.Listen != "" {
+		server := api.NewServer(cfg, anal, db, searcher, supervisors)
+		go func() {
+			if err := server.Start(ctx); err != nil {
+				log.Printf("API server error: %v", err)
+			}
+		}()
+	}
 
 	log.Println("Connecting to Telegram...")
 
-	// Start Telegram client (blocking until ctx cancelled or error)
-	if err := tgClient.Start(ctx); err != nil {
-		// If error is due to ctx cancellation, it's not a fatal error
-		if ctx.Err() == nil {
-			log.Fatalf("Telegram client error: %v", err)
-		}
+	// Run the Telegram clients, restarting them on transient failures. It only
+	// returns on shutdown or when no account's session can be used anymore.
+	runErr := supervisors.Run(ctx)
+	if runErr != nil {
+		runErr = fmt.Errorf("telegram client error: %w", runErr)
+		log.Print(runErr)
 	}
 
+	// Restore default signal handling so a second signal exits right away
+	cancel()
+	log.Println("Waiting for the final analysis, press Ctrl+C again to exit immediately")
+	wg.Wait()
 	log.Println("Service stopped")
-	// Give some time for background tasks to clean up
-	time.Sleep(time.Second)
+	return runErr
 }